@@ -2,13 +2,12 @@ package main
 
 import (
 	"context"
-	"strings"
-	"time"
+	"fmt"
 
 	_ "embed"
 
+	"github.com/binarycraft007/fast-graphrag-go/graphrag"
 	"github.com/binarycraft007/fast-graphrag-go/llms"
-	"github.com/binarycraft007/fast-graphrag-go/services"
 	"github.com/binarycraft007/fast-graphrag-go/types"
 )
 
@@ -16,38 +15,41 @@ import (
 var data string
 
 func main() {
-	entiryTypes := []string{"Character", "Animal", "Place", "Object", "Activity", "Event"}
 	ctx := context.Background()
 	llm, err := llms.NewVertexAILLMService(ctx, llms.WithProjectID("XXXXXXXXX"), llms.WithLocation("us-central1"))
 	if err != nil {
 		panic(err)
 	}
 	defer llm.Client.Close()
-	chunkService := services.NewDefaultChunkingService()
-	chunks := chunkService.Extract([]types.Document{
-		{Data: data},
-	})
-	infoExtract := services.DefaultInformationExtractionService{}
-	_, err = infoExtract.Extract(
-		llm,
-		chunks,
-		map[string]any{
-			"domain": "Analyze this story and identify the characters. Focus on how they interact with each other, the locations they explore, and their relationships.",
-			"example_queries": []string{
-				"What is the significance of Christmas Eve in A Christmas Carol?",
-				"How does the setting of Victorian London contribute to the story's themes?",
-				"Describe the chain of events that leads to Scrooge's transformation.",
-				"How does Dickens use the different spirits (Past, Present, and Future) to guide Scrooge?",
-				"Why does Dickens choose to divide the story into \"staves\" rather than chapters?",
-			},
-			"entity_types": strings.Join(entiryTypes, ","),
+	embedder, err := llms.NewVertexAIEmbedder(ctx, "XXXXXXXXX", "us-central1")
+	if err != nil {
+		panic(err)
+	}
+	defer embedder.Client.Close()
+	rag, err := graphrag.New(graphrag.Config{
+		Domain: "Analyze this story and identify the characters. Focus on how they interact with each other, the locations they explore, and their relationships.",
+		ExampleQueries: []string{
+			"What is the significance of Christmas Eve in A Christmas Carol?",
+			"How does the setting of Victorian London contribute to the story's themes?",
+			"Describe the chain of events that leads to Scrooge's transformation.",
+			"How does Dickens use the different spirits (Past, Present, and Future) to guide Scrooge?",
+			"Why does Dickens choose to divide the story into \"staves\" rather than chapters?",
 		},
-		entiryTypes,
-	)
+		EntityTypes: []string{"Character", "Animal", "Place", "Object", "Activity", "Event"},
+		LLM:         llm,
+		Embedder:    embedder,
+		WorkingDir:  "./book_example",
+	})
 	if err != nil {
 		panic(err)
 	}
-	for {
-		time.Sleep(time.Second * 1)
+	if err := rag.Insert(ctx, []types.Document{{Data: data}}); err != nil {
+		panic(err)
+	}
+	response, err := rag.Query(ctx, "Who is Scrooge?")
+	if err != nil {
+		panic(err)
 	}
+	fmt.Println(response.Response)
+	fmt.Println(rag.Usage())
 }
@@ -0,0 +1,206 @@
+// Package graphrag builds a knowledge graph from documents and answers
+// questions over it, hiding the chunking, extraction and retrieval pipeline.
+package graphrag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+	"github.com/binarycraft007/fast-graphrag-go/services"
+	"github.com/binarycraft007/fast-graphrag-go/storage"
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// Config configures a GraphRAG instance.
+type Config struct {
+	// Domain describes what to focus on when extracting the graph.
+	Domain string
+	// ExampleQueries are questions the graph should be able to answer.
+	ExampleQueries []string
+	// EntityTypes are the types of entities to extract.
+	EntityTypes []string
+
+	// LLM extracts the graph and answers queries.
+	LLM llms.ChatModel
+	// Embedder embeds entities for linking them to queries. It can be of
+	// another provider than LLM, and defaults to LLM if LLM is also an
+	// llms.Embedder.
+	Embedder llms.Embedder
+
+	// RateLimit limits the concurrency and rate of the requests to LLM, e.g.
+	// to stay within the quota of the provider. The zero value is unlimited.
+	RateLimit llms.RateLimitConfig
+	// EmbedderRateLimit limits the requests to Embedder.
+	EmbedderRateLimit llms.RateLimitConfig
+
+	// Graph, Entities and Chunks are the storage backends. They default to
+	// in-memory storages.
+	Graph    storage.BaseGraphStorage[types.Entity, types.Relation, string]
+	Entities storage.BaseVectorStorage[string]
+	Chunks   storage.ChunkStorage
+
+	// GraphUpsert merges extracted graphs into Graph. Defaults to
+	// services.NewDefaultGraphUpsertPolicy.
+	GraphUpsert services.BaseGraphUpsertPolicy[types.Entity, types.Relation, string]
+	// MaxGleaningSteps is the number of extra extraction rounds per chunk.
+	MaxGleaningSteps int
+	// MaxConcurrentChunks is the maximum number of chunks extracted at a
+	// time. Defaults to RateLimit.MaxConcurrent; zero in both is unlimited.
+	MaxConcurrentChunks int
+
+	// Pricing prices the token usage reported by Usage, by model name.
+	Pricing map[string]llms.Pricing
+
+	// WorkingDir is the directory the storages are saved to after every
+	// Insert and loaded from by New. The storages are only kept in memory
+	// when it is empty.
+	WorkingDir string
+}
+
+// GraphRAG inserts documents into a knowledge graph and queries it.
+type GraphRAG struct {
+	config     Config
+	chunking   *services.DefaultChunkingService
+	extraction *services.DefaultInformationExtractionService
+	state      *services.DefaultStateManagerService
+	query      *services.DefaultQueryService
+	usage      *llms.UsageTracker
+}
+
+// New creates a GraphRAG instance from config.
+func New(config Config) (*GraphRAG, error) {
+	if config.LLM == nil {
+		return nil, errors.New("graphrag: LLM is required")
+	}
+	if len(config.EntityTypes) == 0 {
+		return nil, errors.New("graphrag: at least one entity type is required")
+	}
+	if config.Embedder == nil {
+		embedder, ok := config.LLM.(llms.Embedder)
+		if !ok {
+			return nil, errors.New("graphrag: Embedder is required")
+		}
+		config.Embedder = embedder
+	}
+	if config.RateLimit != (llms.RateLimitConfig{}) {
+		config.LLM = llms.NewRateLimitedLLMService(config.LLM, config.RateLimit)
+	}
+	if config.EmbedderRateLimit != (llms.RateLimitConfig{}) {
+		config.Embedder = llms.NewRateLimitedEmbedder(config.Embedder, config.EmbedderRateLimit)
+	}
+
+	state := services.NewDefaultStateManagerService(config.Embedder)
+	if config.Graph != nil {
+		state.Graph = config.Graph
+	}
+	if config.Entities != nil {
+		state.Entities = config.Entities
+	}
+	if config.Chunks != nil {
+		state.Chunks = config.Chunks
+	}
+	if config.GraphUpsert != nil {
+		state.GraphUpsert = config.GraphUpsert
+	}
+	if config.WorkingDir != "" {
+		workingDir, err := storage.NewWorkingDir(config.WorkingDir)
+		if err != nil {
+			return nil, err
+		}
+		state.WorkingDir = workingDir
+		if err := state.Load(); err != nil {
+			return nil, err
+		}
+	}
+
+	extraction := &services.DefaultInformationExtractionService{}
+	extraction.MaxGleaningSteps = config.MaxGleaningSteps
+	extraction.MaxConcurrentChunks = config.MaxConcurrentChunks
+	if extraction.MaxConcurrentChunks == 0 {
+		extraction.MaxConcurrentChunks = config.RateLimit.MaxConcurrent
+	}
+	extraction.GraphUpsert = state.GraphUpsert
+
+	return &GraphRAG{
+		config:     config,
+		chunking:   services.NewDefaultChunkingService(),
+		extraction: extraction,
+		state:      state,
+		query:      &services.DefaultQueryService{Extraction: extraction, State: state},
+		usage:      llms.NewUsageTracker(),
+	}, nil
+}
+
+// Insert chunks the documents, extracts a graph from the chunks which have
+// not been inserted before and merges it into the storages. Documents whose
+// extraction fails are skipped and reported in the returned error, so they
+// are retried by the next Insert. Insert fails before any extraction if the
+// metadata of a chunk cannot be saved, see storage.CheckChunks.
+func (g *GraphRAG) Insert(ctx context.Context, documents []types.Document) error {
+	ctx = g.withUsage(ctx)
+	chunks := g.state.FilterNewChunks(g.chunking.Extract(documents))
+	for i, documentChunks := range chunks {
+		if err := storage.CheckChunks(documentChunks); err != nil {
+			return fmt.Errorf("graphrag: document %d: %w", i, err)
+		}
+	}
+
+	if err := g.state.InsertStart(); err != nil {
+		return err
+	}
+	results, err := g.extraction.Extract(ctx, g.config.LLM, chunks, g.promptArgs(), g.config.EntityTypes)
+	if err != nil {
+		return errors.Join(err, g.state.InsertDone())
+	}
+
+	var errs []error
+	for i, result := range results {
+		extracted := <-result
+		if extracted.Err != nil {
+			errs = append(errs, fmt.Errorf("graphrag: extracting document %d: %w", i, extracted.Err))
+			continue
+		}
+		documentCtx := llms.WithDocument(ctx, services.DocumentLabel(i, chunks[i]))
+		if err := g.state.Upsert(documentCtx, g.config.LLM, extracted.Graph, chunks[i]); err != nil {
+			errs = append(errs, fmt.Errorf("graphrag: inserting document %d: %w", i, err))
+		}
+	}
+	return errors.Join(append(errs, g.state.InsertDone())...)
+}
+
+// Query answers question from the inserted documents.
+func (g *GraphRAG) Query(ctx context.Context, question string) (*services.QueryResponse, error) {
+	return g.query.Query(g.withUsage(ctx), g.config.LLM, question, g.promptArgs())
+}
+
+// QueryStream is like Query but streams the answer as it is generated.
+// The returned response holds the entities and the context of the answer.
+func (g *GraphRAG) QueryStream(ctx context.Context, question string) (*services.QueryResponse, iter.Seq2[llms.StreamChunk, error], error) {
+	return g.query.QueryStream(g.withUsage(ctx), g.config.LLM, question, g.promptArgs())
+}
+
+// Usage reports the tokens used by Insert and Query since New, priced with
+// Config.Pricing. Calls whose context carries its own llms.UsageTracker
+// are recorded there instead.
+func (g *GraphRAG) Usage() llms.UsageReport {
+	return g.usage.Report(g.config.Pricing)
+}
+
+func (g *GraphRAG) withUsage(ctx context.Context) context.Context {
+	if llms.UsageTrackerFrom(ctx) != nil {
+		return ctx
+	}
+	return llms.WithUsageTracker(ctx, g.usage)
+}
+
+func (g *GraphRAG) promptArgs() map[string]any {
+	return map[string]any{
+		"domain":          g.config.Domain,
+		"example_queries": strings.Join(g.config.ExampleQueries, "\n"),
+		"entity_types":    strings.Join(g.config.EntityTypes, ","),
+	}
+}
@@ -0,0 +1,176 @@
+package graphrag
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+	"github.com/binarycraft007/fast-graphrag-go/llms/llmtest"
+	"github.com/binarycraft007/fast-graphrag-go/services"
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+const testDocument = "Alice works with Bob at the Lab. Bob founded the Lab in Paris."
+
+// newTestLLM scripts the extraction of testDocument and the answers to
+// questions about Alice.
+func newTestLLM() *llmtest.FakeLLM {
+	return llmtest.NewFakeLLM().
+		On("entity_relationship_extraction", types.Graph{
+			Entities: []types.Entity{
+				{Name: "Alice", Type: "PERSON", Description: "Works at the Lab."},
+				{Name: "Bob", Type: "PERSON", Description: "Founder of the Lab."},
+				{Name: "Lab", Type: "ORGANIZATION", Description: "A lab in Paris."},
+			},
+			Relationships: []types.Relation{
+				{Source: "Alice", Target: "Bob", Description: "works with"},
+				{Source: "Bob", Target: "Lab", Description: "founded"},
+			},
+		}).
+		On("entity_extraction_query", services.QueryEntities{Named: []string{"Alice"}}).
+		Add(llmtest.Rule{
+			PromptKey: "generate_response_query",
+			Respond: func(prompt string, config llms.MessageConfig) (any, error) {
+				if !strings.Contains(prompt, testDocument) {
+					return "I do not know.", nil
+				}
+				return " Alice works with Bob. ", nil
+			},
+		})
+}
+
+func TestInsertQuery(t *testing.T) {
+	llm := newTestLLM()
+	g, err := New(Config{
+		LLM:         llm,
+		EntityTypes: []string{"PERSON", "ORGANIZATION"},
+		WorkingDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := g.Insert(ctx, []types.Document{{Data: testDocument}}); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := g.Query(ctx, "Who does Alice work with?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Response != "Alice works with Bob." {
+		t.Errorf("got answer %q", response.Response)
+	}
+	if len(response.Entities) != 1 || response.Entities[0].Name != "ALICE" {
+		t.Errorf("got query entities %v, want ALICE", response.Entities)
+	}
+	// ALICE and the entities connected to it are ranked.
+	if n := len(response.Context.Entities); n != 3 {
+		t.Errorf("got %d context entities, want the 3 connected to ALICE", n)
+	}
+	if len(response.Context.Chunks) != 1 || response.Context.Chunks[0].Chunk.Content != testDocument {
+		t.Errorf("got context chunks %v, want the document", response.Context.Chunks)
+	}
+
+	_, stream, err := g.QueryStream(ctx, "Who does Alice work with?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var answer strings.Builder
+	for chunk, err := range stream {
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer.WriteString(chunk.Delta)
+	}
+	if !strings.Contains(answer.String(), "Alice works with Bob.") {
+		t.Errorf("got streamed answer %q", answer.String())
+	}
+
+	// The document is not extracted again, neither by this instance nor by
+	// one loading the working directory.
+	calls := len(llm.Calls())
+	if err := g.Insert(ctx, []types.Document{{Data: testDocument}}); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := New(Config{LLM: llm, EntityTypes: []string{"PERSON"}, WorkingDir: g.config.WorkingDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Insert(ctx, []types.Document{{Data: testDocument}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(llm.Calls()) != calls {
+		t.Errorf("inserting the document again sent %d messages", len(llm.Calls())-calls)
+	}
+	response, err = reloaded.Query(ctx, "Who does Alice work with?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Response != "Alice works with Bob." {
+		t.Errorf("got answer %q after reloading", response.Response)
+	}
+}
+
+func TestInsertExtractionError(t *testing.T) {
+	errExtraction := errors.New("model overloaded")
+	llm := llmtest.NewFakeLLM().
+		Add(llmtest.Rule{PromptKey: "entity_relationship_extraction", Err: errExtraction, Times: 1}).
+		On("entity_relationship_extraction", types.Graph{Entities: []types.Entity{{Name: "Alice", Type: "PERSON"}}})
+	g, err := New(Config{LLM: llm, EntityTypes: []string{"PERSON"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	err = g.Insert(ctx, []types.Document{{Data: testDocument}})
+	if !errors.Is(err, errExtraction) {
+		t.Fatalf("got %v, want the extraction error", err)
+	}
+
+	// The failed document is extracted again by the next Insert.
+	if err := g.Insert(ctx, []types.Document{{Data: testDocument}}); err != nil {
+		t.Fatal(err)
+	}
+	if g.state.Graph.NodeCount() == 0 {
+		t.Error("the document was not inserted again")
+	}
+}
+
+func TestInsertUnsavableMetadata(t *testing.T) {
+	llm := newTestLLM()
+	g, err := New(Config{LLM: llm, EntityTypes: []string{"PERSON"}, WorkingDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// gob cannot encode the unregistered time.Time in a metadata map.
+	document := types.Document{Data: testDocument, Metadata: map[string]any{"date": time.Now()}}
+	if err := g.Insert(context.Background(), []types.Document{document}); err == nil {
+		t.Fatal("got no error for metadata which cannot be saved")
+	}
+	if calls := llm.Calls(); len(calls) != 0 {
+		t.Errorf("the rejected document was extracted with %d calls", len(calls))
+	}
+	if n := g.state.Graph.NodeCount(); n != 0 {
+		t.Errorf("the rejected document added %d entities", n)
+	}
+
+	// Common slices and maps are registered.
+	document.Metadata = map[string]any{
+		"date":    time.Now().Format(time.DateOnly),
+		"authors": []string{"Alice", "Bob"},
+		"tags":    map[string]string{"topic": "research"},
+	}
+	if err := g.Insert(context.Background(), []types.Document{document}); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := New(Config{LLM: llm, EntityTypes: []string{"PERSON"}, WorkingDir: g.config.WorkingDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := reloaded.state.Chunks.Size(); n != 1 {
+		t.Errorf("reloaded %d chunks, want 1", n)
+	}
+}
@@ -0,0 +1,189 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms/jsonschema"
+)
+
+const (
+	anthropicVersion = "2023-06-01"
+	// anthropicResponseTool is the tool the model is forced to call to return
+	// structured output.
+	anthropicResponseTool = "respond"
+	// anthropicItemsProperty wraps non-object responses, as tool inputs must be objects.
+	anthropicItemsProperty = "items"
+)
+
+// AnthropicLLMService implements the ChatModel interface for the Anthropic
+// Messages API. Anthropic has no embeddings API; pair it with an Embedder
+// of another provider.
+type AnthropicLLMService struct {
+	Config     *MessageConfig
+	APIKey     string
+	MaxRetries int
+	Client     *http.Client
+}
+
+func DefaultAnthropicLLMOptions() *MessageConfig {
+	return &MessageConfig{
+		Model:        "claude-sonnet-4-5",
+		MaxTokens:    8000,
+		ResponseType: reflect.TypeOf(""),
+		BaseURL:      "https://api.anthropic.com/v1",
+	}
+}
+
+// NewAnthropicLLMService initializes an Anthropic-based LLM service.
+func NewAnthropicLLMService(ctx context.Context, apiKey string, options ...MessageOptions) (*AnthropicLLMService, error) {
+	config := DefaultAnthropicLLMOptions()
+	for _, opt := range options {
+		opt(config)
+	}
+	if config.BaseURL == "" {
+		return nil, errors.New("base url is required")
+	}
+	return &AnthropicLLMService{
+		Config:     config,
+		APIKey:     apiKey,
+		MaxRetries: 3,
+		Client:     http.DefaultClient,
+	}, nil
+}
+
+type anthropicTool struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	InputSchema *jsonschema.Schema `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicRequest struct {
+	Model       string               `json:"model"`
+	MaxTokens   int                  `json:"max_tokens"`
+	System      string               `json:"system,omitempty"`
+	Messages    []openAIMessage      `json:"messages"`
+	Temperature float64              `json:"temperature"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// SendMessage sends a message to the language model and receives a response.
+// Structured responses are obtained by forcing a call of a tool whose input
+// schema is generated from the response type.
+func (a *AnthropicLLMService) SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error) {
+	config := *a.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	messages, err := openAIMessages(MessageConfig{HistoryMessages: config.HistoryMessages}, prompt)
+	if err != nil {
+		return nil, err
+	}
+	request := anthropicRequest{
+		Model:     config.Model,
+		MaxTokens: config.MaxTokens,
+		System:    config.SystemPrompt,
+		Messages:  messages,
+	}
+
+	wrapped := false
+	switch config.ResponseType.Kind() {
+	case reflect.String:
+	case reflect.Slice, reflect.Array, reflect.Struct:
+		schema, err := jsonschema.GenerateSchemaFromType(config.ResponseType)
+		if err != nil {
+			return nil, err
+		}
+		if schema.Type != "object" {
+			schema = &jsonschema.Schema{
+				Type:       "object",
+				Properties: map[string]*jsonschema.Schema{anthropicItemsProperty: schema},
+				Required:   []string{anthropicItemsProperty},
+			}
+			wrapped = true
+		}
+		request.Tools = []anthropicTool{{
+			Name:        anthropicResponseTool,
+			Description: "Respond with the requested structured output.",
+			InputSchema: schema,
+		}}
+		request.ToolChoice = &anthropicToolChoice{Type: "tool", Name: anthropicResponseTool}
+	default:
+		return nil, errors.New("unsupported type")
+	}
+
+	header := make(http.Header)
+	header.Set("x-api-key", a.APIKey)
+	header.Set("anthropic-version", anthropicVersion)
+	var response anthropicResponse
+	url := strings.TrimSuffix(config.BaseURL, "/") + "/messages"
+	if err := Retry(ctx, retryConfig(a.MaxRetries), func() error {
+		return postJSON(ctx, a.Client, url, header, request, &response)
+	}); err != nil {
+		return nil, err
+	}
+	RecordUsage(ctx, config.Model, Usage{
+		PromptTokens:     response.Usage.InputTokens,
+		CompletionTokens: response.Usage.OutputTokens,
+	})
+
+	if config.ResponseType.Kind() == reflect.String {
+		var output string
+		for _, block := range response.Content {
+			if block.Type == "text" {
+				output += block.Text
+			}
+		}
+		return output, nil
+	}
+	for _, block := range response.Content {
+		if block.Type != "tool_use" || block.Name != anthropicResponseTool {
+			continue
+		}
+		input := block.Input
+		if wrapped {
+			var items map[string]json.RawMessage
+			if err := json.Unmarshal(input, &items); err != nil {
+				return nil, err
+			}
+			input = items[anthropicItemsProperty]
+		}
+		return unmarshalResponse(config.ResponseType, string(input))
+	}
+	return nil, fmt.Errorf("no tool call in response, stop reason %q", response.StopReason)
+}
+
+// StartChat starts a conversation.
+func (a *AnthropicLLMService) StartChat(options ...MessageOptions) *ChatSession {
+	return NewChatSession(a, options...)
+}
+
+func (a *AnthropicLLMService) messageConfig() MessageConfig {
+	return *a.Config
+}
@@ -0,0 +1,102 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAnthropicSendMessage(t *testing.T) {
+	server := newTestServer(t, func(body map[string]any) (int, any) {
+		return http.StatusOK, map[string]any{
+			"content":     []any{map[string]any{"type": "text", "text": "Hello."}},
+			"stop_reason": "end_turn",
+			"usage":       map[string]any{"input_tokens": 4, "output_tokens": 2},
+		}
+	})
+	llm, err := NewAnthropicLLMService(context.Background(), "key", WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := llm.SendMessage(context.Background(), "Hi.", WithSystemPrompt("Be brief."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "Hello." {
+		t.Errorf("got %v, want Hello.", response)
+	}
+
+	request := server.lastRequest(t)
+	if request.Path != "/messages" {
+		t.Errorf("request sent to %s", request.Path)
+	}
+	if request.Header.Get("x-api-key") != "key" || request.Header.Get("anthropic-version") != anthropicVersion {
+		t.Errorf("got headers %v", request.Header)
+	}
+	// The system prompt is a field of the request, not a message.
+	if request.Body["system"] != "Be brief." || len(request.Body["messages"].([]any)) != 1 || request.Body["tools"] != nil {
+		t.Errorf("got request %v", request.Body)
+	}
+}
+
+func TestAnthropicStructuredOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		responseType reflect.Type
+		input        string
+		want         any
+	}{
+		{"object", reflect.TypeOf(testAnswer{}), `{"answer":"yes"}`, &testAnswer{Answer: "yes"}},
+		{"array", reflect.TypeOf([]testAnswer{}), `{"items":[{"answer":"yes"}]}`, &[]testAnswer{{Answer: "yes"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, func(body map[string]any) (int, any) {
+				return http.StatusOK, map[string]any{
+					"content": []any{
+						map[string]any{"type": "text", "text": "Calling the tool."},
+						map[string]any{"type": "tool_use", "name": anthropicResponseTool, "input": json.RawMessage(test.input)},
+					},
+					"stop_reason": "tool_use",
+				}
+			})
+			llm, err := NewAnthropicLLMService(context.Background(), "key", WithBaseURL(server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := llm.SendMessage(context.Background(), "Answer.", WithResponseType(test.responseType))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(response, test.want) {
+				t.Errorf("got %#v, want %#v", response, test.want)
+			}
+
+			body := server.lastRequest(t).Body
+			if choice := jsonPath(body, "tool_choice", "name"); choice != anthropicResponseTool {
+				t.Errorf("got tool choice %v", choice)
+			}
+			if schemaType := jsonPath(body, "tools", 0, "input_schema", "type"); schemaType != "object" {
+				t.Errorf("got input schema of type %v, want object", schemaType)
+			}
+		})
+	}
+}
+
+func TestAnthropicMissingToolCall(t *testing.T) {
+	server := newTestServer(t, func(body map[string]any) (int, any) {
+		return http.StatusOK, map[string]any{
+			"content":     []any{map[string]any{"type": "text", "text": "No."}},
+			"stop_reason": "max_tokens",
+		}
+	})
+	llm, err := NewAnthropicLLMService(context.Background(), "key", WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := llm.SendMessage(context.Background(), "Answer.", WithResponseType(reflect.TypeOf(testAnswer{}))); err == nil {
+		t.Error("got no error for a response without tool call")
+	}
+}
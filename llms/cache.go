@@ -0,0 +1,316 @@
+package llms
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms/jsonschema"
+)
+
+// ErrCacheMiss is returned by a read-only CachedLLMService or
+// CachedEmbedder for a request it has no cached response to.
+var ErrCacheMiss = errors.New("cache miss")
+
+// configurable is implemented by the services of this package to expose
+// the configuration their requests start from.
+type configurable interface {
+	messageConfig() MessageConfig
+}
+
+// baseConfig returns the configuration of llm, or an empty one if it does
+// not expose it.
+func baseConfig(llm ChatModel) MessageConfig {
+	if c, ok := llm.(configurable); ok {
+		return c.messageConfig()
+	}
+	return MessageConfig{}
+}
+
+// embeddingConfigurable is implemented by the embedders of this package to
+// expose the configuration their requests start from.
+type embeddingConfigurable interface {
+	embeddingConfig() EmbeddingConfig
+}
+
+// baseEmbeddingConfig returns the configuration of embedder, or an empty
+// one if it does not expose it.
+func baseEmbeddingConfig(embedder Embedder) EmbeddingConfig {
+	if c, ok := embedder.(embeddingConfigurable); ok {
+		return c.embeddingConfig()
+	}
+	return EmbeddingConfig{}
+}
+
+// Fingerprint identifies a request by the provider, the model, the prompt,
+// the system prompt, the history and the schema of the response type.
+// Requests with the same fingerprint are expected to get the same response.
+func Fingerprint(provider string, config MessageConfig, prompt string) (string, error) {
+	var schema *jsonschema.Schema
+	responseType := "string"
+	if config.ResponseType != nil && config.ResponseType.Kind() != reflect.String {
+		var err error
+		if schema, err = jsonschema.GenerateSchemaFromType(config.ResponseType); err != nil {
+			return "", err
+		}
+		responseType = config.ResponseType.String()
+	}
+	return fingerprint(struct {
+		Provider     string             `json:"provider"`
+		Model        string             `json:"model"`
+		Prompt       string             `json:"prompt"`
+		SystemPrompt string             `json:"system_prompt"`
+		History      []Message          `json:"history"`
+		ResponseType string             `json:"response_type"`
+		Schema       *jsonschema.Schema `json:"schema"`
+	}{provider, config.Model, prompt, config.SystemPrompt, config.HistoryMessages, responseType, schema})
+}
+
+// embeddingFingerprint identifies the embedding of text.
+func embeddingFingerprint(provider string, config EmbeddingConfig, text string) (string, error) {
+	return fingerprint(struct {
+		Provider     string `json:"provider"`
+		Model        string `json:"model"`
+		EmbeddingDim int    `json:"embedding_dim"`
+		Text         string `json:"text"`
+	}{provider, config.Model, config.Dimension, text})
+}
+
+func fingerprint(key any) (string, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CachedLLMService stores the responses of a ChatModel on disk and returns
+// them for identical requests, so re-running an ingestion does not pay for
+// the requests again.
+type CachedLLMService struct {
+	LLM ChatModel
+	// Dir is the directory of the cache files.
+	Dir string
+	// Provider distinguishes the cache entries of different providers. It
+	// defaults to the type of LLM.
+	Provider string
+	// ReadOnly serves the cached responses only, e.g. to run CI from a
+	// committed cache: a miss returns ErrCacheMiss without calling LLM.
+	ReadOnly bool
+}
+
+// NewCachedLLMService wraps llm to cache its responses in dir, which is
+// created if it does not exist.
+func NewCachedLLMService(llm ChatModel, dir string, readOnly bool) (*CachedLLMService, error) {
+	if !readOnly {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &CachedLLMService{
+		LLM:      llm,
+		Dir:      dir,
+		Provider: fmt.Sprintf("%T", llm),
+		ReadOnly: readOnly,
+	}, nil
+}
+
+// SendMessage returns the cached response of an identical request or
+// sends the message and caches its response.
+func (c *CachedLLMService) SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error) {
+	config := baseConfig(c.LLM)
+	for _, opt := range options {
+		opt(&config)
+	}
+	key, err := Fingerprint(c.Provider, config, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	var cached json.RawMessage
+	found, err := readCacheEntry(c.Dir, key, &cached)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if config.ResponseType == nil || config.ResponseType.Kind() == reflect.String {
+			var output string
+			err := json.Unmarshal(cached, &output)
+			return output, err
+		}
+		return unmarshalResponse(config.ResponseType, string(cached))
+	}
+	if c.ReadOnly {
+		return nil, fmt.Errorf("%w: prompt %.80q", ErrCacheMiss, prompt)
+	}
+
+	response, err := c.LLM.SendMessage(ctx, prompt, options...)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCacheEntry(c.Dir, key, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// SendMessageStream streams the response of the wrapped service. Streams
+// are not cached.
+func (c *CachedLLMService) SendMessageStream(ctx context.Context, prompt string, options ...MessageOptions) iter.Seq2[StreamChunk, error] {
+	return Stream(ctx, c.LLM, prompt, options...)
+}
+
+// StartChat starts a conversation.
+func (c *CachedLLMService) StartChat(options ...MessageOptions) *ChatSession {
+	return NewChatSession(c, options...)
+}
+
+func (c *CachedLLMService) messageConfig() MessageConfig {
+	return baseConfig(c.LLM)
+}
+
+// CachedEmbedder stores the embeddings of an Embedder on disk and returns
+// them for identical texts, like CachedLLMService.
+type CachedEmbedder struct {
+	Embedder Embedder
+	// Dir is the directory of the cache files. It can be shared with a
+	// CachedLLMService.
+	Dir string
+	// Provider distinguishes the cache entries of different providers. It
+	// defaults to the type of Embedder.
+	Provider string
+	// ReadOnly serves the cached embeddings only: a miss returns
+	// ErrCacheMiss without calling Embedder.
+	ReadOnly bool
+}
+
+// NewCachedEmbedder wraps embedder to cache its embeddings in dir, which is
+// created if it does not exist.
+func NewCachedEmbedder(embedder Embedder, dir string, readOnly bool) (*CachedEmbedder, error) {
+	if !readOnly {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &CachedEmbedder{
+		Embedder: embedder,
+		Dir:      dir,
+		Provider: fmt.Sprintf("%T", embedder),
+		ReadOnly: readOnly,
+	}, nil
+}
+
+// GetEmbedding returns the cached embeddings of texts and retrieves the
+// missing ones.
+func (c *CachedEmbedder) GetEmbedding(ctx context.Context, texts []string, options ...EmbeddingOptions) ([]Embedding, error) {
+	config := baseEmbeddingConfig(c.Embedder)
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	embeddings := make([]Embedding, len(texts))
+	keys := make([]string, len(texts))
+	var missing []int
+	for i, text := range texts {
+		key, err := embeddingFingerprint(c.Provider, config, text)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+		found, err := readCacheEntry(c.Dir, key, &embeddings[i].Vector)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+	if c.ReadOnly {
+		return nil, fmt.Errorf("%w: embedding of %.80q", ErrCacheMiss, texts[missing[0]])
+	}
+
+	missingTexts := make([]string, len(missing))
+	for i, idx := range missing {
+		missingTexts[i] = texts[idx]
+	}
+	retrieved, err := c.Embedder.GetEmbedding(ctx, missingTexts, options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(retrieved) != len(missing) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(retrieved), len(missing))
+	}
+	for i, idx := range missing {
+		embeddings[idx] = retrieved[i]
+		if err := writeCacheEntry(c.Dir, keys[idx], retrieved[i].Vector); err != nil {
+			return nil, err
+		}
+	}
+	return embeddings, nil
+}
+
+func (c *CachedEmbedder) embeddingConfig() EmbeddingConfig {
+	return baseEmbeddingConfig(c.Embedder)
+}
+
+// cachePath returns the path of the entry key in dir.
+func cachePath(dir, key string) string {
+	return filepath.Join(dir, key[:2], key+".json")
+}
+
+// readCacheEntry decodes the entry key of dir into value. It reports false
+// if there is none.
+func readCacheEntry(dir, key string, value any) (bool, error) {
+	data, err := os.ReadFile(cachePath(dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("reading cache entry %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// writeCacheEntry atomically stores value as the entry key of dir.
+func writeCacheEntry(dir, key string, value any) (err error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	path := cachePath(dir, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+key+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,160 @@
+package llms_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+	"github.com/binarycraft007/fast-graphrag-go/llms/llmtest"
+)
+
+type cachedAnswer struct {
+	Text  string   `json:"text"`
+	Items []string `json:"items"`
+}
+
+// countFiles returns the number of files under dir.
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fs.SkipAll
+		}
+		if err == nil && !entry.IsDir() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCachedLLMService(t *testing.T) {
+	ctx := context.Background()
+	fake := llmtest.NewFakeLLM().
+		On("answer", cachedAnswer{Text: "42", Items: []string{"a", "b"}}).
+		OnMatch(".", "Hello.")
+	cache, err := llms.NewCachedLLMService(fake, t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(options ...llms.MessageOptions) any {
+		t.Helper()
+		response, err := cache.SendMessage(ctx, "Hi.", options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	calls := func() int { return len(fake.Calls()) }
+
+	if response := send(); response != "Hello." {
+		t.Errorf("got %v, want Hello.", response)
+	}
+	if response := send(); response != "Hello." || calls() != 1 {
+		t.Errorf("identical request: got %v after %d calls, want a hit", response, calls())
+	}
+
+	history := []llms.Message{llms.ChatMessage{Role: llms.RoleUser, Content: "Before."}}
+	for name, option := range map[string]llms.MessageOptions{
+		"model":         llms.WithModel("other"),
+		"system prompt": llms.WithSystemPrompt("Be brief."),
+		"history":       llms.WithHistoryMessges(history),
+		"response type": llms.WithResponseType(reflect.TypeOf(cachedAnswer{})),
+	} {
+		before := calls()
+		send(option, llms.WithPromptKey("answer"))
+		if calls() != before+1 {
+			t.Errorf("changing the %s is a hit, want a miss", name)
+		}
+	}
+
+	// The structured response comes back from the cache as the same type.
+	structured := llms.WithResponseType(reflect.TypeOf(cachedAnswer{}))
+	before := calls()
+	response := send(structured, llms.WithPromptKey("answer"))
+	want := &cachedAnswer{Text: "42", Items: []string{"a", "b"}}
+	if !reflect.DeepEqual(response, want) || calls() != before {
+		t.Errorf("got %#v after %d calls, want the cached %#v", response, calls()-before, want)
+	}
+}
+
+func TestCachedLLMServiceReadOnly(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fake := llmtest.NewFakeLLM().OnMatch(".", "Hello.")
+	writer, err := llms.NewCachedLLMService(fake, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.SendMessage(ctx, "Hi."); err != nil {
+		t.Fatal(err)
+	}
+	files := countFiles(t, dir)
+
+	reader, err := llms.NewCachedLLMService(fake, dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, err := reader.SendMessage(ctx, "Hi."); err != nil || response != "Hello." {
+		t.Errorf("got %v, %v, want the cached response", response, err)
+	}
+	if _, err := reader.SendMessage(ctx, "Bye."); !errors.Is(err, llms.ErrCacheMiss) {
+		t.Errorf("got %v, want ErrCacheMiss", err)
+	}
+	if n := len(fake.Calls()); n != 1 {
+		t.Errorf("the service received %d messages, want only the one of the writer", n)
+	}
+	if n := countFiles(t, dir); n != files {
+		t.Errorf("read-only cache wrote %d files", n-files)
+	}
+}
+
+func TestCachedEmbedder(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fake := llmtest.NewFakeLLM()
+	cache, err := llms.NewCachedEmbedder(fake, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := cache.GetEmbedding(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countFiles(t, dir); n != 2 {
+		t.Fatalf("got %d cache files, want 2", n)
+	}
+
+	// A read-only cache serves the cached texts in any order, and fails on
+	// the others without writing.
+	reader, err := llms.NewCachedEmbedder(fake, dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := reader.GetEmbedding(ctx, []string{"b", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(first[0].Vector, second[1].Vector) || !slices.Equal(first[1].Vector, second[0].Vector) {
+		t.Error("cached embeddings differ from the retrieved ones")
+	}
+	if _, err := reader.GetEmbedding(ctx, []string{"a", "c"}); !errors.Is(err, llms.ErrCacheMiss) {
+		t.Errorf("got %v, want ErrCacheMiss", err)
+	}
+	if _, err := cache.GetEmbedding(ctx, []string{"a"}, llms.WithEmbeddingDim(8)); err != nil {
+		t.Fatal(err)
+	}
+	if n := countFiles(t, dir); n != 3 {
+		t.Errorf("got %d cache files, want another dimension to be another entry", n)
+	}
+}
@@ -0,0 +1,58 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+)
+
+// ChatSession is a conversation with a ChatModel. Every message is sent
+// with the history of the previous messages and their responses, while the
+// service itself keeps no state between requests. A session is not safe for
+// concurrent use; start one session per conversation.
+type ChatSession struct {
+	LLM ChatModel
+
+	options []MessageOptions
+	history []ChatMessage
+}
+
+// NewChatSession starts a conversation with llm. The options apply to every
+// message of the session.
+func NewChatSession(llm ChatModel, options ...MessageOptions) *ChatSession {
+	return &ChatSession{LLM: llm, options: options}
+}
+
+// SendMessage sends prompt with the history of the session and appends the
+// prompt and the response to the history. Structured responses are recorded
+// as their JSON encoding.
+func (c *ChatSession) SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error) {
+	history := make([]Message, len(c.history))
+	for i, message := range c.history {
+		history[i] = message
+	}
+	options = append(slices.Clone(c.options), options...)
+	response, err := c.LLM.SendMessage(ctx, prompt, append(options, WithHistoryMessges(history))...)
+	if err != nil {
+		return nil, err
+	}
+
+	content, ok := response.(string)
+	if !ok {
+		data, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+		content = string(data)
+	}
+	c.history = append(c.history,
+		ChatMessage{Role: RoleUser, Content: prompt},
+		ChatMessage{Role: RoleAssistant, Content: content},
+	)
+	return response, nil
+}
+
+// History returns the messages of the session and their responses.
+func (c *ChatSession) History() []ChatMessage {
+	return slices.Clone(c.history)
+}
@@ -0,0 +1,101 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrInvalidEmbedding is returned when an embedder returns an empty vector
+// or a vector of another dimension than the configured one.
+var ErrInvalidEmbedding = errors.New("invalid embedding")
+
+// embedBatchFunc embeds a batch of texts in one request.
+type embedBatchFunc func(ctx context.Context, texts []string) ([]Embedding, error)
+
+// embedInBatches splits texts into batches within the BatchSize and
+// MaxBatchTokens limits of config and embeds them with embed, up to
+// MaxConcurrentBatches at a time. The embeddings are returned in the order
+// of texts, once their dimension is checked against config.
+func embedInBatches(ctx context.Context, config EmbeddingConfig, texts []string, embed embedBatchFunc) ([]Embedding, error) {
+	batches := splitBatches(texts, config.BatchSize, config.MaxBatchTokens)
+	embeddings := make([]Embedding, len(texts))
+	errs := make([]error, len(batches))
+	slots := make(chan struct{}, max(config.MaxConcurrentBatches, 1))
+
+	var wg sync.WaitGroup
+	offset := 0
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			result, err := embed(ctx, batch)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if len(result) != len(batch) {
+				errs[i] = fmt.Errorf("got %d embeddings for %d texts", len(result), len(batch))
+				return
+			}
+			copy(embeddings[offset:], result)
+		}(offset)
+		offset += len(batch)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if err := checkDimension(embeddings, config.Dimension); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// splitBatches splits texts into consecutive batches of at most maxItems
+// texts and maxTokens estimated tokens. A text larger than maxTokens is
+// sent alone. Zero limits are unlimited.
+func splitBatches(texts []string, maxItems, maxTokens int) [][]string {
+	var batches [][]string
+	start, tokens := 0, 0
+	for i, text := range texts {
+		textTokens := estimateTokens([]string{text})
+		full := maxItems > 0 && i-start >= maxItems ||
+			maxTokens > 0 && tokens+textTokens > maxTokens
+		if i > start && full {
+			batches = append(batches, texts[start:i])
+			start, tokens = i, 0
+		}
+		tokens += textTokens
+	}
+	if start < len(texts) {
+		batches = append(batches, texts[start:])
+	}
+	return batches
+}
+
+// checkDimension checks that the embeddings have dimension components, or
+// all have the same number of components if dimension is zero.
+func checkDimension(embeddings []Embedding, dimension int) error {
+	for i, embedding := range embeddings {
+		if len(embedding.Vector) == 0 {
+			return fmt.Errorf("%w: empty vector for text %d", ErrInvalidEmbedding, i)
+		}
+		if dimension == 0 {
+			dimension = len(embedding.Vector)
+		}
+		if len(embedding.Vector) != dimension {
+			return fmt.Errorf("%w: got %d dimensions for text %d, want %d", ErrInvalidEmbedding, len(embedding.Vector), i, dimension)
+		}
+	}
+	return nil
+}
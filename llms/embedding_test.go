@@ -0,0 +1,153 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSplitBatches(t *testing.T) {
+	// Each text of 8 characters is estimated to 2 tokens.
+	texts := []string{"aaaaaaaa", "bbbbbbbb", "cccccccc", "dddddddd", "eeeeeeee"}
+	long := strings.Repeat("x", 40)
+	tests := []struct {
+		name      string
+		texts     []string
+		maxItems  int
+		maxTokens int
+		want      [][]string
+	}{
+		{"unlimited", texts, 0, 0, [][]string{texts}},
+		{"items", texts, 2, 0, [][]string{texts[:2], texts[2:4], texts[4:]}},
+		{"tokens", texts, 0, 5, [][]string{texts[:2], texts[2:4], texts[4:]}},
+		{"items and tokens", texts, 3, 4, [][]string{texts[:2], texts[2:4], texts[4:]}},
+		{"text over the token limit alone", []string{"aaaaaaaa", long, "bbbbbbbb"}, 0, 4, [][]string{{"aaaaaaaa"}, {long}, {"bbbbbbbb"}}},
+		{"no texts", nil, 2, 2, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitBatches(test.texts, test.maxItems, test.maxTokens)
+			if !slices.EqualFunc(got, test.want, slices.Equal[[]string]) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// indexEmbeddings embeds the texts "0", "1", ... as vectors holding their
+// number, so that the order of the results can be checked.
+func indexEmbeddings(texts []string, dimension int) ([]Embedding, error) {
+	embeddings := make([]Embedding, len(texts))
+	for i, text := range texts {
+		var n float32
+		if _, err := fmt.Sscan(text, &n); err != nil {
+			return nil, err
+		}
+		embeddings[i].Vector = make([]float32, dimension)
+		embeddings[i].Vector[0] = n
+	}
+	return embeddings, nil
+}
+
+func TestEmbedInBatches(t *testing.T) {
+	texts := make([]string, 25)
+	for i := range texts {
+		texts[i] = fmt.Sprint(i)
+	}
+	config := EmbeddingConfig{Dimension: 4, BatchSize: 3, MaxConcurrentBatches: 2}
+
+	var mu sync.Mutex
+	running, peak, batches := 0, 0, 0
+	embeddings, err := embedInBatches(context.Background(), config, texts, func(ctx context.Context, batch []string) ([]Embedding, error) {
+		mu.Lock()
+		running++
+		batches++
+		peak = max(peak, running)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		if len(batch) > config.BatchSize {
+			return nil, fmt.Errorf("batch of %d texts", len(batch))
+		}
+		time.Sleep(5 * time.Millisecond)
+		return indexEmbeddings(batch, config.Dimension)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batches != 9 {
+		t.Errorf("got %d batches, want 9", batches)
+	}
+	if peak > config.MaxConcurrentBatches {
+		t.Errorf("%d batches at a time, want at most %d", peak, config.MaxConcurrentBatches)
+	}
+	for i, embedding := range embeddings {
+		if embedding.Vector[0] != float32(i) {
+			t.Fatalf("embedding %d is the one of text %v", i, embedding.Vector[0])
+		}
+	}
+}
+
+func TestEmbedInBatchesErrors(t *testing.T) {
+	texts := []string{"0", "1", "2", "3"}
+	config := EmbeddingConfig{Dimension: 2, BatchSize: 2}
+	errBatch := errors.New("batch failed")
+	tests := []struct {
+		name    string
+		embed   embedBatchFunc
+		wantErr error
+	}{
+		{"batch error", func(ctx context.Context, batch []string) ([]Embedding, error) {
+			if batch[0] == "2" {
+				return nil, errBatch
+			}
+			return indexEmbeddings(batch, 2)
+		}, errBatch},
+		{"wrong dimension", func(ctx context.Context, batch []string) ([]Embedding, error) {
+			return indexEmbeddings(batch, 3)
+		}, ErrInvalidEmbedding},
+		{"empty vector", func(ctx context.Context, batch []string) ([]Embedding, error) {
+			return make([]Embedding, len(batch)), nil
+		}, ErrInvalidEmbedding},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := embedInBatches(context.Background(), config, texts, test.embed); !errors.Is(err, test.wantErr) {
+				t.Errorf("got %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+
+	_, err := embedInBatches(context.Background(), config, texts, func(ctx context.Context, batch []string) ([]Embedding, error) {
+		return indexEmbeddings(batch[:1], 2)
+	})
+	if err == nil {
+		t.Error("got no error for missing embeddings")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = embedInBatches(ctx, EmbeddingConfig{BatchSize: 1}, texts, func(ctx context.Context, batch []string) ([]Embedding, error) {
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestCheckGoogleAIDimension(t *testing.T) {
+	for dimension, valid := range map[int]bool{0: true, googleAIEmbeddingDimension: true, 256: false} {
+		err := checkGoogleAIDimension(EmbeddingConfig{Dimension: dimension})
+		if (err == nil) != valid {
+			t.Errorf("dimension %d: got %v", dimension, err)
+		}
+	}
+}
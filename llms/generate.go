@@ -0,0 +1,65 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrInvalidResponse is returned when a response does not decode to the
+// requested type or fails its validation.
+var ErrInvalidResponse = errors.New("invalid response")
+
+// Validator is implemented by response types which check their decoded value.
+type Validator interface {
+	Validate() error
+}
+
+// Generate sends prompt and returns the response decoded as T. The response
+// schema is derived from T, and the value is validated if T implements
+// Validator.
+func Generate[T any](ctx context.Context, llm MessageSender, prompt string, options ...MessageOptions) (T, error) {
+	var value T
+	options = append(options, WithResponseType(reflect.TypeFor[T]()))
+	response, err := llm.SendMessage(ctx, prompt, options...)
+	if err != nil {
+		return value, err
+	}
+
+	switch response := response.(type) {
+	case T:
+		value = response
+	case *T:
+		if response == nil {
+			return value, fmt.Errorf("%w: empty %T", ErrInvalidResponse, response)
+		}
+		value = *response
+	default:
+		return value, fmt.Errorf("%w: got %T, want %s", ErrInvalidResponse, response, reflect.TypeFor[T]())
+	}
+
+	if validator, ok := any(&value).(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return value, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+	}
+	return value, nil
+}
+
+// FormatAndGenerate formats the prompt template promptKey with formatArg
+// and generates a response of type T from it.
+func FormatAndGenerate[T any](
+	ctx context.Context,
+	promptKey string,
+	llm MessageSender,
+	formatArg any,
+	options ...MessageOptions,
+) (T, error) {
+	prompt, err := FormatPrompt(promptKey, formatArg)
+	if err != nil {
+		var value T
+		return value, err
+	}
+	return Generate[T](ctx, llm, prompt, append(options, WithPromptKey(promptKey))...)
+}
@@ -0,0 +1,103 @@
+package llms_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+	"github.com/binarycraft007/fast-graphrag-go/llms/llmtest"
+)
+
+type validatedAnswer struct {
+	Text string `json:"text"`
+}
+
+var errEmptyAnswer = errors.New("empty answer")
+
+func (a *validatedAnswer) Validate() error {
+	if a.Text == "" {
+		return errEmptyAnswer
+	}
+	return nil
+}
+
+// senderFunc returns the responses of a function.
+type senderFunc func(prompt string, config llms.MessageConfig) (any, error)
+
+func (f senderFunc) SendMessage(ctx context.Context, prompt string, options ...llms.MessageOptions) (any, error) {
+	var config llms.MessageConfig
+	for _, opt := range options {
+		opt(&config)
+	}
+	return f(prompt, config)
+}
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+	fake := llmtest.NewFakeLLM().
+		On("answer", `{"text": "42"}`).
+		On("empty", validatedAnswer{})
+
+	answer, err := llms.Generate[validatedAnswer](ctx, fake, "What is the answer?", llms.WithPromptKey("answer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Text != "42" {
+		t.Errorf("got %+v, want 42", answer)
+	}
+	if config := fake.Calls()[0].Config; config.ResponseType != reflect.TypeFor[validatedAnswer]() {
+		t.Errorf("got response type %v, want validatedAnswer", config.ResponseType)
+	}
+
+	_, err = llms.Generate[validatedAnswer](ctx, fake, "What is the answer?", llms.WithPromptKey("empty"))
+	if !errors.Is(err, llms.ErrInvalidResponse) || !errors.Is(err, errEmptyAnswer) {
+		t.Errorf("got %v, want the validation error", err)
+	}
+
+	errSend := errors.New("scripted error")
+	failing := llmtest.NewFakeLLM().Add(llmtest.Rule{Err: errSend})
+	if _, err := llms.Generate[validatedAnswer](ctx, failing, "?"); !errors.Is(err, errSend) {
+		t.Errorf("got %v, want the error of the LLM", err)
+	}
+}
+
+func TestGenerateWrongType(t *testing.T) {
+	ctx := context.Background()
+	for name, response := range map[string]any{
+		"other type":  "42",
+		"nil pointer": (*validatedAnswer)(nil),
+		"nil":         nil,
+	} {
+		sender := senderFunc(func(string, llms.MessageConfig) (any, error) { return response, nil })
+		if _, err := llms.Generate[validatedAnswer](ctx, sender, "?"); !errors.Is(err, llms.ErrInvalidResponse) {
+			t.Errorf("%s: got %v, want ErrInvalidResponse", name, err)
+		}
+	}
+}
+
+func TestFormatAndGenerate(t *testing.T) {
+	ctx := context.Background()
+	fake := llmtest.NewFakeLLM().On("summarize_entity_descriptions", " A cryptographer. ")
+
+	args := map[string]any{"name": "ALICE", "description": "Works on ciphers."}
+	summary, err := llms.FormatAndGenerate[string](ctx, "summarize_entity_descriptions", fake, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != " A cryptographer. " {
+		t.Errorf("got %q, want the response", summary)
+	}
+	call := fake.Calls()[0]
+	if want, _ := llms.FormatPrompt("summarize_entity_descriptions", args); call.Prompt != want {
+		t.Errorf("got prompt %q, want %q", call.Prompt, want)
+	}
+
+	if _, err := llms.FormatAndGenerate[string](ctx, "no_such_prompt", fake, args); err == nil {
+		t.Error("got no error for an unknown prompt key")
+	}
+	if n := len(fake.Calls()); n != 1 {
+		t.Errorf("got %d calls, want none for the unknown prompt key", n-1)
+	}
+}
@@ -2,25 +2,23 @@ package llms
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"iter"
 	"reflect"
 
 	"github.com/binarycraft007/fast-graphrag-go/llms/googleai"
-	"github.com/binarycraft007/fast-graphrag-go/types"
 	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
-// OpenAILLMService implements the LLMService interface for OpenAI.
+// GoogleAILLMService implements the ChatModel interface for the Gemini API.
 type GoogleAILLMService struct {
-	Config       *MessageConfig
-	APIKey       string
-	MaxRetries   int
-	Client       *genai.Client
-	MaxTokens    int
-	EmbeddingDim int
+	Config     *MessageConfig
+	APIKey     string
+	MaxRetries int
+	Client     *genai.Client
 }
 
 func DefaultGoogleAILLMOptions() *MessageConfig {
@@ -28,7 +26,6 @@ func DefaultGoogleAILLMOptions() *MessageConfig {
 		Model:        "gemini-1.5-flash-002",
 		MaxTokens:    8000,
 		ResponseType: reflect.TypeOf(""),
-		EmbeddingDim: 768,
 	}
 }
 
@@ -51,98 +48,273 @@ func NewGoogleAILLMService(ctx context.Context, apiKey string, options ...Messag
 }
 
 // SendMessage sends a message to the language model and receives a response.
+// Transient failures are retried up to MaxRetries times.
 func (g *GoogleAILLMService) SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error) {
+	config := *g.Config
 	for _, opt := range options {
-		opt(g.Config)
+		opt(&config)
 	}
 
-	genaiModel := g.Client.GenerativeModel(g.Config.Model)
+	var response any
+	err := Retry(ctx, retryConfig(g.MaxRetries), func() (err error) {
+		response, err = g.sendMessage(ctx, prompt, config)
+		return err
+	})
+	return response, err
+}
+
+func (g *GoogleAILLMService) sendMessage(ctx context.Context, prompt string, config MessageConfig) (any, error) {
+	cs, err := g.newChat(config)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cs.SendMessage(ctx, genai.Text(prompt))
+	if err != nil {
+		return nil, err
+	}
+	if resp.UsageMetadata != nil {
+		RecordUsage(ctx, config.Model, Usage{
+			PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+			CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+		})
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, errors.New("no candidates in response")
+	}
+
+	var output string
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if text, ok := part.(genai.Text); ok {
+			output += string(text)
+		}
+	}
+	if config.ResponseType.Kind() == reflect.String {
+		return output, nil
+	}
+	return unmarshalResponse(config.ResponseType, output)
+}
+
+// newChat starts a chat session configured by config.
+func (g *GoogleAILLMService) newChat(config MessageConfig) (*genai.ChatSession, error) {
+	genaiModel := g.Client.GenerativeModel(config.Model)
 	genaiModel.SetCandidateCount(1)
 	genaiModel.SetTemperature(0)
-	genaiModel.SetMaxOutputTokens(int32(g.Config.MaxTokens))
-
-	cs := genaiModel.StartChat()
-	if g.Config.SystemPrompt != "" {
+	genaiModel.SetMaxOutputTokens(int32(config.MaxTokens))
+	if config.SystemPrompt != "" {
 		genaiModel.SystemInstruction = &genai.Content{
 			Role:  "system",
-			Parts: []genai.Part{genai.Text(g.Config.SystemPrompt)},
+			Parts: []genai.Part{genai.Text(config.SystemPrompt)},
 		}
 	}
-	for _, content := range g.Config.HistoryMessages {
-		cs.History = append(cs.History, content.(*genai.Content))
-	}
-	switch g.Config.ResponseType.Kind() {
+	switch config.ResponseType.Kind() {
 	case reflect.String:
-		resp, err := cs.SendMessage(ctx, genai.Text(prompt))
-		if err != nil {
-			return nil, err
-		}
-		var output string
-		for _, part := range resp.Candidates[0].Content.Parts {
-			if text, ok := part.(genai.Text); ok {
-				output += string(text)
-			}
-		}
-		return output, nil
 	case reflect.Slice, reflect.Array, reflect.Struct:
-		schema, err := googleai.GenerateSchemaFromType(g.Config.ResponseType)
+		schema, err := googleai.GenerateSchemaFromType(config.ResponseType)
 		if err != nil {
 			return nil, err
 		}
 		genaiModel.GenerationConfig.ResponseMIMEType = "application/json"
 		genaiModel.GenerationConfig.ResponseSchema = schema
-		resp, err := cs.SendMessage(ctx, genai.Text(prompt))
-		if err != nil {
-			return nil, err
-		}
+	default:
+		return nil, errors.New("unsupported type")
+	}
 
-		var jsonData string
-		for _, part := range resp.Candidates[0].Content.Parts {
-			if text, ok := part.(genai.Text); ok {
-				jsonData += string(text)
-			}
+	cs := genaiModel.StartChat()
+	history, err := genaiHistory(config.HistoryMessages)
+	if err != nil {
+		return nil, err
+	}
+	cs.History = history
+	return cs, nil
+}
+
+// SendMessageStream streams the text response to prompt. Transient
+// failures are retried up to MaxRetries times until the first chunk arrives.
+func (g *GoogleAILLMService) SendMessageStream(ctx context.Context, prompt string, options ...MessageOptions) iter.Seq2[StreamChunk, error] {
+	config := *g.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	return func(yield func(StreamChunk, error) bool) {
+		if config.ResponseType.Kind() != reflect.String {
+			yield(StreamChunk{}, errors.New("only text responses can be streamed"))
+			return
 		}
+		// Stopping the iteration early cancels the request.
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
 
-		// Create a new instance of the type using reflect.New
-		instance := reflect.New(g.Config.ResponseType).Interface()
+		var it *genai.GenerateContentResponseIterator
+		var resp *genai.GenerateContentResponse
+		err := Retry(ctx, retryConfig(g.MaxRetries), func() error {
+			// A chat session records the prompt in its history on every
+			// send, so each attempt starts a new one.
+			cs, err := g.newChat(config)
+			if err != nil {
+				return err
+			}
+			it = cs.SendMessageStream(ctx, genai.Text(prompt))
+			resp, err = it.Next()
+			return err
+		})
 
-		// Unmarshal JSON into the dynamically created instance
-		err = json.Unmarshal([]byte(jsonData), instance)
-		if err != nil {
-			return nil, fmt.Errorf("Error unmarshaling: %v", err)
+		var last StreamChunk
+		for ; err == nil; resp, err = it.Next() {
+			if resp.UsageMetadata != nil {
+				last.Usage = Usage{
+					PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+					CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+				}
+			}
+			if len(resp.Candidates) == 0 {
+				continue
+			}
+			candidate := resp.Candidates[0]
+			if candidate.FinishReason != genai.FinishReasonUnspecified {
+				last.FinishReason = candidate.FinishReason.String()
+			}
+			if candidate.Content == nil {
+				continue
+			}
+			var delta string
+			for _, part := range candidate.Content.Parts {
+				if text, ok := part.(genai.Text); ok {
+					delta += string(text)
+				}
+			}
+			if delta != "" && !yield(StreamChunk{Delta: delta}, nil) {
+				return
+			}
 		}
-		return instance, nil
-	default:
-		return nil, errors.New("unsupported type")
+		if !errors.Is(err, iterator.Done) {
+			yield(StreamChunk{}, err)
+			return
+		}
+		RecordUsage(ctx, config.Model, last.Usage)
+		last.Done = true
+		yield(last, nil)
 	}
 }
 
-// GetEmbedding retrieves embeddings for the given texts.
-func (g *GoogleAILLMService) GetEmbedding(ctx context.Context, texts []string, options ...MessageOptions) ([]Embedding, error) {
-	for _, opt := range options {
-		opt(g.Config)
+// genaiHistory converts history messages, either ChatMessage or
+// *genai.Content, to the contents of a chat session.
+func genaiHistory(messages []Message) ([]*genai.Content, error) {
+	history := make([]*genai.Content, len(messages))
+	for i, message := range messages {
+		switch message := message.(type) {
+		case *genai.Content:
+			history[i] = message
+		case ChatMessage:
+			role := "user"
+			if message.Role == RoleAssistant {
+				role = "model"
+			}
+			history[i] = &genai.Content{Role: role, Parts: []genai.Part{genai.Text(message.Content)}}
+		default:
+			return nil, fmt.Errorf("unsupported history message type %T", message)
+		}
 	}
+	return history, nil
+}
 
-	chunks := chunkTexts(texts, g.MaxTokens*types.TOKEN_TO_CHAR_RATIO)
+// StartChat starts a conversation.
+func (g *GoogleAILLMService) StartChat(options ...MessageOptions) *ChatSession {
+	return NewChatSession(g, options...)
+}
 
-	model := g.Client.EmbeddingModel(g.Config.Model)
-	batch := model.NewBatch()
+func (g *GoogleAILLMService) messageConfig() MessageConfig {
+	return *g.Config
+}
 
-	for _, chunk := range chunks {
-		for _, text := range chunk {
-			batch.AddContent(genai.Text(text))
-		}
+// GoogleAIEmbedder implements the Embedder interface for the Gemini API.
+// The dimension of the embeddings is the one of the model, as the SDK
+// cannot request another one: Config.Dimension is either
+// googleAIEmbeddingDimension, the dimension of the default model, or zero
+// to accept the dimension of another model.
+type GoogleAIEmbedder struct {
+	Config     *EmbeddingConfig
+	APIKey     string
+	MaxRetries int
+	Client     *genai.Client
+}
+
+// googleAIEmbeddingDimension is the dimension of text-embedding-004.
+const googleAIEmbeddingDimension = 768
+
+func DefaultGoogleAIEmbeddingOptions() *EmbeddingConfig {
+	return &EmbeddingConfig{
+		Model:                "text-embedding-004",
+		Dimension:            googleAIEmbeddingDimension,
+		BatchSize:            100,
+		MaxConcurrentBatches: 4,
 	}
+}
 
-	resp, err := model.BatchEmbedContents(ctx, batch)
+// NewGoogleAIEmbedder initializes a Gemini API based embedder.
+func NewGoogleAIEmbedder(ctx context.Context, apiKey string, options ...EmbeddingOptions) (*GoogleAIEmbedder, error) {
+	config := DefaultGoogleAIEmbeddingOptions()
+	for _, opt := range options {
+		opt(config)
+	}
+	if err := checkGoogleAIDimension(*config); err != nil {
+		return nil, err
+	}
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
 	if err != nil {
 		return nil, err
 	}
+	return &GoogleAIEmbedder{
+		Config:     config,
+		APIKey:     apiKey,
+		MaxRetries: 3,
+		Client:     client,
+	}, nil
+}
 
-	embeddings := make([]Embedding, len(resp.Embeddings))
-	for i, embedding := range resp.Embeddings {
-		copy(embeddings[i].Vector, embedding.Values)
+// GetEmbedding retrieves embeddings for the given texts.
+func (g *GoogleAIEmbedder) GetEmbedding(ctx context.Context, texts []string, options ...EmbeddingOptions) ([]Embedding, error) {
+	config := *g.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+	if err := checkGoogleAIDimension(config); err != nil {
+		return nil, err
 	}
 
-	return embeddings, nil
+	model := g.Client.EmbeddingModel(config.Model)
+	return embedInBatches(ctx, config, texts, func(ctx context.Context, batch []string) ([]Embedding, error) {
+		request := model.NewBatch()
+		for _, text := range batch {
+			request.AddContent(genai.Text(text))
+		}
+
+		var resp *genai.BatchEmbedContentsResponse
+		if err := Retry(ctx, retryConfig(g.MaxRetries), func() (err error) {
+			resp, err = model.BatchEmbedContents(ctx, request)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		RecordUsage(ctx, config.Model, Usage{EmbeddingTokens: estimateTokens(batch)})
+
+		embeddings := make([]Embedding, len(resp.Embeddings))
+		for i, embedding := range resp.Embeddings {
+			embeddings[i].Vector = embedding.Values
+		}
+		return embeddings, nil
+	})
+}
+
+// checkGoogleAIDimension rejects the dimensions GoogleAIEmbedder cannot
+// request.
+func checkGoogleAIDimension(config EmbeddingConfig) error {
+	if config.Dimension != 0 && config.Dimension != googleAIEmbeddingDimension {
+		return fmt.Errorf("the Gemini API embedder cannot set the dimension to %d, use %d or 0 for the dimension of the model", config.Dimension, googleAIEmbeddingDimension)
+	}
+	return nil
+}
+
+func (g *GoogleAIEmbedder) embeddingConfig() EmbeddingConfig {
+	return *g.Config
 }
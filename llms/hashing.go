@@ -0,0 +1,191 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// HashingEmbedder implements the Embedder interface without any provider.
+// Texts are split into word and character n-grams which are hashed into
+// the components of the vector, weighted by TF-IDF and L2 normalized.
+// The embeddings are deterministic and only capture lexical similarity,
+// which is enough to deduplicate and link entities offline and gives a
+// baseline to compare provider embeddings against.
+//
+// The inverse document frequencies are learned by Fit, which must be called
+// before the first embedding as it would change the weights of the vectors
+// already computed. Without Fit, which the graphrag pipeline never calls,
+// the n-grams are weighted by their frequency in the text only. Texts
+// without letters or digits are embedded from a hash of their whole
+// content. It is safe for concurrent use.
+type HashingEmbedder struct {
+	Config *EmbeddingConfig
+	// MaxWordNGram is the length of the longest word n-grams, from single
+	// words up.
+	MaxWordNGram int
+	// MinCharNGram and MaxCharNGram bound the length of the character
+	// n-grams of each word. Zero MaxCharNGram disables them.
+	MinCharNGram int
+	MaxCharNGram int
+
+	mu                sync.RWMutex
+	documents         int
+	documentFrequency map[uint64]int
+	// embedded is set by the first embedding, after which Fit fails.
+	embedded atomic.Bool
+}
+
+// ErrFitAfterEmbedding is returned by Fit once HashingEmbedder has
+// computed embeddings.
+var ErrFitAfterEmbedding = errors.New("fit after embedding")
+
+func DefaultHashingEmbeddingOptions() *EmbeddingConfig {
+	return &EmbeddingConfig{
+		Model:     "hashing",
+		Dimension: 1024,
+	}
+}
+
+// NewHashingEmbedder initializes an embedder with word unigrams and bigrams
+// and character n-grams of 3 to 5 characters.
+func NewHashingEmbedder(options ...EmbeddingOptions) (*HashingEmbedder, error) {
+	config := DefaultHashingEmbeddingOptions()
+	for _, opt := range options {
+		opt(config)
+	}
+	if config.Dimension <= 0 {
+		return nil, errors.New("dimension must be positive")
+	}
+	return &HashingEmbedder{
+		Config:            config,
+		MaxWordNGram:      2,
+		MinCharNGram:      3,
+		MaxCharNGram:      5,
+		documentFrequency: make(map[uint64]int),
+	}, nil
+}
+
+// Fit adds texts to the corpus the inverse document frequencies are
+// computed from. It returns ErrFitAfterEmbedding once GetEmbedding has been
+// called.
+func (h *HashingEmbedder) Fit(texts []string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.embedded.Load() {
+		return ErrFitAfterEmbedding
+	}
+	for _, text := range texts {
+		for feature := range h.features(text) {
+			h.documentFrequency[feature]++
+		}
+		h.documents++
+	}
+	return nil
+}
+
+// GetEmbedding computes the embeddings of texts.
+func (h *HashingEmbedder) GetEmbedding(ctx context.Context, texts []string, options ...EmbeddingOptions) ([]Embedding, error) {
+	config := *h.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+	if config.Dimension <= 0 {
+		return nil, errors.New("dimension must be positive")
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.embedded.Store(true)
+	embeddings := make([]Embedding, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		embeddings[i].Vector = h.embed(text, config.Dimension)
+	}
+	RecordUsage(ctx, config.Model, Usage{EmbeddingTokens: estimateTokens(texts)})
+	return embeddings, nil
+}
+
+// embed computes the embedding of text. The caller holds h.mu.
+func (h *HashingEmbedder) embed(text string, dimension int) []float32 {
+	values := make([]float64, dimension)
+	for feature, count := range h.features(text) {
+		// Sublinear term frequency, and smoothed inverse document frequency.
+		weight := 1 + math.Log(float64(count))
+		weight *= math.Log(float64(1+h.documents)/float64(1+h.documentFrequency[feature])) + 1
+		// A sign from the hash makes colliding features cancel out on average.
+		if feature>>63 == 1 {
+			weight = -weight
+		}
+		values[feature%uint64(dimension)] += weight
+	}
+
+	var norm float64
+	for _, value := range values {
+		norm += value * value
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0 {
+		// No features, or features cancelling out: the vector must not be
+		// zero for the vector storages, so it is derived from the text.
+		values[hashFeature("t", text)%uint64(dimension)] = 1
+		norm = 1
+	}
+	vector := make([]float32, dimension)
+	for i, value := range values {
+		vector[i] = float32(value / norm)
+	}
+	return vector
+}
+
+// features counts the hashed word and character n-grams of text.
+func (h *HashingEmbedder) features(text string) map[uint64]int {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	features := make(map[uint64]int)
+	for n := 1; n <= h.MaxWordNGram; n++ {
+		for i := 0; i+n <= len(words); i++ {
+			features[hashFeature("w", strings.Join(words[i:i+n], " "))]++
+		}
+	}
+	if h.MaxCharNGram > 0 {
+		for _, word := range words {
+			runes := []rune(" " + word + " ")
+			for n := max(h.MinCharNGram, 1); n <= h.MaxCharNGram; n++ {
+				for i := 0; i+n <= len(runes); i++ {
+					features[hashFeature("c", string(runes[i:i+n]))]++
+				}
+			}
+		}
+	}
+	return features
+}
+
+// hashFeature hashes an n-gram of kind, so that words and characters do
+// not share features.
+func hashFeature(kind, ngram string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(kind))
+	hash.Write([]byte{0})
+	hash.Write([]byte(ngram))
+	// Mix the bits, as the high bits of FNV barely depend on the last bytes.
+	x := hash.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func (h *HashingEmbedder) embeddingConfig() EmbeddingConfig {
+	return *h.Config
+}
@@ -0,0 +1,65 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+func TestHashingEmbedder(t *testing.T) {
+	h, err := NewHashingEmbedder(WithEmbeddingDim(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Fit([]string{"the cat sat on the mat", "the dog ate the bone"}); err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{"The cat sat on the mat.", "the cat sat on the mat", "A cat on a mat", "Quantum chromodynamics", "", "?!"}
+	embeddings, err := h.GetEmbedding(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, embedding := range embeddings {
+		if len(embedding.Vector) != 256 {
+			t.Fatalf("text %d: got %d dimensions, want 256", i, len(embedding.Vector))
+		}
+		// Texts without letters or digits are not zero vectors either.
+		var squares float64
+		for _, value := range embedding.Vector {
+			squares += float64(value) * float64(value)
+		}
+		if math.Abs(squares-1) > 1e-5 {
+			t.Errorf("text %q: got a squared norm of %v, want 1", texts[i], squares)
+		}
+	}
+	if !slices.Equal(embeddings[0].Vector, embeddings[1].Vector) {
+		t.Error("texts differing in case and punctuation have different embeddings")
+	}
+	if similar, unrelated := cosine(embeddings[0].Vector, embeddings[2].Vector), cosine(embeddings[0].Vector, embeddings[3].Vector); similar <= unrelated {
+		t.Errorf("similar texts have a similarity of %v, unrelated ones %v", similar, unrelated)
+	}
+	if slices.Equal(embeddings[4].Vector, embeddings[5].Vector) {
+		t.Error("different texts without features have the same embedding")
+	}
+	for _, i := range []int{4, 5} {
+		if !slices.ContainsFunc(embeddings[i].Vector, func(value float32) bool { return value != 0 }) {
+			t.Errorf("text %q has a zero vector", texts[i])
+		}
+	}
+
+	if err := h.Fit([]string{"more documents"}); !errors.Is(err, ErrFitAfterEmbedding) {
+		t.Errorf("got %v, want ErrFitAfterEmbedding", err)
+	}
+}
@@ -0,0 +1,122 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAnswer is a structured response type of the provider tests.
+type testAnswer struct {
+	Answer string  `json:"answer"`
+	Score  float64 `json:"score,omitempty"`
+}
+
+// testServer stands in for a provider API. It records the requests it
+// receives and answers with respond.
+type testServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []testRequest
+}
+
+type testRequest struct {
+	Path   string
+	Header http.Header
+	Body   map[string]any
+}
+
+// newTestServer starts a server answering every request with the status
+// and the JSON encoding of the response returned by respond.
+func newTestServer(t *testing.T, respond func(body map[string]any) (int, any)) *testServer {
+	t.Helper()
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var body map[string]any
+		if err := json.Unmarshal(data, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, testRequest{Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+		s.mu.Unlock()
+
+		status, response := respond(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Requests returns the requests received so far.
+func (s *testServer) Requests() []testRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]testRequest(nil), s.requests...)
+}
+
+// lastRequest returns the last request received, failing t if there is none.
+func (s *testServer) lastRequest(t *testing.T) testRequest {
+	t.Helper()
+	requests := s.Requests()
+	if len(requests) == 0 {
+		t.Fatal("no request received")
+	}
+	return requests[len(requests)-1]
+}
+
+// jsonPath returns the value at path in a decoded JSON value, or nil.
+func jsonPath(value any, path ...any) any {
+	for _, key := range path {
+		switch key := key.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil
+			}
+			value = object[key]
+		case int:
+			array, ok := value.([]any)
+			if !ok || key >= len(array) {
+				return nil
+			}
+			value = array[key]
+		}
+	}
+	return value
+}
+
+func TestPostJSONError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		http.Error(w, `{"error":"slow down"}`, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	var response map[string]any
+	err := postJSON(context.Background(), http.DefaultClient, server.URL, nil, map[string]any{}, &response)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got %v, want an APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 2*time.Second {
+		t.Errorf("got %+v, want status 429 and a retry after 2s", apiErr)
+	}
+	if !IsRetryable(err) {
+		t.Error("rate limited request is not retryable")
+	}
+}
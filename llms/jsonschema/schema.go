@@ -0,0 +1,173 @@
+package jsonschema
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Schema is a JSON schema, limited to the keywords used for structured output.
+type Schema struct {
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	// AdditionalProperties allows properties not listed in Properties if
+	// nil or true.
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+}
+
+// GenerateSchemaFromType converts a reflect.Type to a Schema object.
+func GenerateSchemaFromType(typ reflect.Type) (*Schema, error) {
+	schema := &Schema{}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		schema.Type = "object"
+		schema.Properties = make(map[string]*Schema)
+		schema.Required = []string{}
+
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			fieldSchema, err := parseFieldSchema(field)
+			if err != nil {
+				return nil, err
+			}
+
+			jsonTag := field.Tag.Get("json")
+			if jsonTag == "" || jsonTag == "-" {
+				continue
+			}
+
+			jsonParts := strings.Split(jsonTag, ",")
+			jsonName := jsonParts[0]
+
+			if !contains(jsonParts, "omitempty") {
+				schema.Required = append(schema.Required, jsonName)
+			}
+
+			schema.Properties[jsonName] = fieldSchema
+		}
+
+	case reflect.Slice, reflect.Array:
+		schema.Type = "array"
+		elemType := typ.Elem()
+
+		itemSchema, err := GenerateSchemaFromType(elemType)
+		if err != nil {
+			return nil, err
+		}
+
+		schema.Items = itemSchema
+
+	default:
+		schema.Type = goTypeToSchemaType(typ)
+		schema.Format = goTypeToSchemaFormat(typ)
+	}
+
+	return schema, nil
+}
+
+// parseFieldSchema parses a single field to a Schema, handling arrays, structs, and formats.
+func parseFieldSchema(field reflect.StructField) (*Schema, error) {
+	fieldType := field.Type
+	schema := &Schema{
+		Type: goTypeToSchemaType(fieldType),
+	}
+
+	// Set format for primitive types
+	schema.Format = goTypeToSchemaFormat(fieldType)
+
+	switch fieldType.Kind() {
+	case reflect.Slice, reflect.Array:
+		elemType := fieldType.Elem()
+		itemSchema, err := GenerateSchemaFromType(elemType)
+		if err != nil {
+			return nil, err
+		}
+		schema.Items = itemSchema
+
+	case reflect.Struct:
+		nestedSchema, err := GenerateSchemaFromType(fieldType)
+		if err != nil {
+			return nil, err
+		}
+		schema.Type = "object"
+		schema.Properties = nestedSchema.Properties
+		schema.Required = nestedSchema.Required
+	}
+
+	schemaTag := field.Tag.Get("schema")
+	if schemaTag != "" {
+		tags := parseTags(schemaTag)
+		if desc, ok := tags["description"]; ok {
+			schema.Description = desc
+		}
+		if example, ok := tags["example"]; ok {
+			schema.Enum = strings.Split(example, ",")
+		}
+	}
+
+	return schema, nil
+}
+
+// Helper functions
+
+func contains(slice []string, value string) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTags(tag string) map[string]string {
+	parts := strings.Split(tag, ",")
+	tags := make(map[string]string)
+
+	for _, part := range parts {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 {
+			tags[kv[0]] = kv[1]
+		}
+	}
+
+	return tags
+}
+
+func goTypeToSchemaType(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct:
+		return "object"
+	default:
+		return "string"
+	}
+}
+
+func goTypeToSchemaFormat(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int32:
+		return "int32"
+	case reflect.Int64:
+		return "int64"
+	case reflect.Float32:
+		return "float"
+	case reflect.Float64:
+		return "double"
+	default:
+		return ""
+	}
+}
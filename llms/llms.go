@@ -3,36 +3,70 @@ package llms
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"reflect"
 	"text/template"
 
 	"github.com/binarycraft007/fast-graphrag-go/prompts"
 )
 
-// Define a generic LLM service interface
-type LLMService interface {
+// MessageSender sends messages to a language model, either directly or
+// within a ChatSession.
+type MessageSender interface {
 	SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error)
-	GetEmbedding(ctx context.Context, texts []string, options ...MessageOptions) ([]Embedding, error)
+}
+
+// ChatModel generates responses with a language model.
+type ChatModel interface {
+	MessageSender
+	// StartChat starts a conversation whose messages are sent with the
+	// history of the previous ones. The options apply to every message.
+	StartChat(options ...MessageOptions) *ChatSession
+}
+
+// Embedder computes the embeddings of texts. It is configured separately
+// from the chat models, so any ChatModel can be paired with any Embedder.
+type Embedder interface {
+	GetEmbedding(ctx context.Context, texts []string, options ...EmbeddingOptions) ([]Embedding, error)
+}
+
+// LLMService is implemented by services which both generate responses and
+// compute embeddings.
+type LLMService interface {
+	ChatModel
+	Embedder
 }
 
 func FormatAndSendPrompt(
 	ctx context.Context,
 	promptKey string,
-	llm LLMService,
+	llm MessageSender,
 	formatArg any,
 	options ...MessageOptions,
 ) (any, error) {
-	buf := new(bytes.Buffer) // Create a new buffer
-	prompt := prompts.Prompts[promptKey]
-	tmpl, err := template.New(promptKey).Parse(prompt)
+	formatedPrompt, err := FormatPrompt(promptKey, formatArg)
 	if err != nil {
 		return nil, err
 	}
+	return llm.SendMessage(ctx, formatedPrompt, append(options, WithPromptKey(promptKey))...)
+}
+
+// FormatPrompt executes the prompt template promptKey with formatArg.
+func FormatPrompt(promptKey string, formatArg any) (string, error) {
+	prompt, ok := prompts.Prompts[promptKey]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt %q", promptKey)
+	}
+	tmpl, err := template.New(promptKey).Parse(prompt)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
 	if err = tmpl.Execute(buf, formatArg); err != nil {
-		return nil, err
+		return "", err
 	}
-	formatedPrompt := buf.String()
-	return llm.SendMessage(ctx, formatedPrompt, options...)
+	return buf.String(), nil
 }
 
 // MessageOptions for customizing LLM requests.
@@ -42,9 +76,12 @@ type MessageConfig struct {
 	HistoryMessages []Message
 	MaxTokens       int
 	ResponseType    reflect.Type
-	EmbeddingDim    int
 	ProjectID       string
 	Location        string
+	BaseURL         string
+	// PromptKey is the key of the prompt template the message was formatted
+	// from, set by FormatAndSendPrompt and FormatAndGenerate.
+	PromptKey string
 }
 
 type MessageOptions func(mc *MessageConfig)
@@ -73,12 +110,6 @@ func WithMaxTokens(maxTokens int) MessageOptions {
 	}
 }
 
-func WithEmbeddingDim(embeddingDim int) MessageOptions {
-	return func(mc *MessageConfig) {
-		mc.EmbeddingDim = embeddingDim
-	}
-}
-
 func WithResponseType(responseType reflect.Type) MessageOptions {
 	return func(mc *MessageConfig) {
 		mc.ResponseType = responseType
@@ -97,11 +128,89 @@ func WithLocation(location string) MessageOptions {
 	}
 }
 
+func WithBaseURL(baseURL string) MessageOptions {
+	return func(mc *MessageConfig) {
+		mc.BaseURL = baseURL
+	}
+}
+
+func WithPromptKey(promptKey string) MessageOptions {
+	return func(mc *MessageConfig) {
+		mc.PromptKey = promptKey
+	}
+}
+
 type Message interface{}
 
-// EmbeddingOptions defines parameters for generating embeddings.
-type EmbeddingOptions struct {
+// Roles of a ChatMessage.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ChatMessage is a provider independent message which can be passed in
+// HistoryMessages.
+type ChatMessage struct {
+	Role    string
+	Content string
+}
+
+// EmbeddingConfig configures the requests of an Embedder.
+type EmbeddingConfig struct {
 	Model string
+	// Dimension is the length of the embedding vectors. Zero uses the
+	// default of the model.
+	Dimension int
+	// BatchSize is the maximum number of texts embedded per request.
+	BatchSize int
+	// MaxBatchTokens is the maximum number of tokens embedded per request,
+	// estimated from the text length. Zero is unlimited.
+	MaxBatchTokens int
+	// MaxConcurrentBatches is the maximum number of requests in flight for
+	// one call. Zero sends the requests one at a time.
+	MaxConcurrentBatches int
+	ProjectID            string
+	Location             string
+	BaseURL              string
+}
+
+// EmbeddingOptions for customizing embedding requests.
+type EmbeddingOptions func(ec *EmbeddingConfig)
+
+func WithEmbeddingModel(model string) EmbeddingOptions {
+	return func(ec *EmbeddingConfig) {
+		ec.Model = model
+	}
+}
+
+func WithEmbeddingDim(dimension int) EmbeddingOptions {
+	return func(ec *EmbeddingConfig) {
+		ec.Dimension = dimension
+	}
+}
+
+func WithEmbeddingBatchSize(batchSize int) EmbeddingOptions {
+	return func(ec *EmbeddingConfig) {
+		ec.BatchSize = batchSize
+	}
+}
+
+func WithEmbeddingMaxBatchTokens(maxBatchTokens int) EmbeddingOptions {
+	return func(ec *EmbeddingConfig) {
+		ec.MaxBatchTokens = maxBatchTokens
+	}
+}
+
+func WithEmbeddingMaxConcurrentBatches(maxConcurrentBatches int) EmbeddingOptions {
+	return func(ec *EmbeddingConfig) {
+		ec.MaxConcurrentBatches = maxConcurrentBatches
+	}
+}
+
+func WithEmbeddingBaseURL(baseURL string) EmbeddingOptions {
+	return func(ec *EmbeddingConfig) {
+		ec.BaseURL = baseURL
+	}
 }
 
 // Embedding represents a single embedding vector.
@@ -109,15 +218,15 @@ type Embedding struct {
 	Vector []float32
 }
 
-// Helper function to chunk texts into smaller groups.
-func chunkTexts(texts []string, chunkSize int) [][]string {
-	var chunks [][]string
-	for i := 0; i < len(texts); i += chunkSize {
-		end := i + chunkSize
-		if end > len(texts) {
-			end = len(texts)
-		}
-		chunks = append(chunks, texts[i:end])
+// unmarshalResponse decodes the JSON text of a structured response into a
+// new instance of responseType.
+func unmarshalResponse(responseType reflect.Type, jsonData string) (any, error) {
+	// Create a new instance of the type using reflect.New
+	instance := reflect.New(responseType).Interface()
+
+	// Unmarshal JSON into the dynamically created instance
+	if err := json.Unmarshal([]byte(jsonData), instance); err != nil {
+		return nil, fmt.Errorf("Error unmarshaling: %v", err)
 	}
-	return chunks
+	return instance, nil
 }
@@ -0,0 +1,241 @@
+package llmtest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+)
+
+// ErrNotRecorded is returned by a replaying Cassette for a request it has
+// no recording of.
+var ErrNotRecorded = errors.New("llmtest: request not recorded")
+
+// Mode selects whether a Cassette records or replays.
+type Mode int
+
+const (
+	// ModeReplay answers from the recordings only, without a service.
+	ModeReplay Mode = iota
+	// ModeRecord sends every request to the service and records it.
+	ModeRecord
+	// ModeReplayOrRecord replays the recorded requests and records the
+	// others.
+	ModeReplayOrRecord
+)
+
+// interaction is a recorded message and its response.
+type interaction struct {
+	PromptKey string          `json:"prompt_key,omitempty"`
+	Prompt    string          `json:"prompt"`
+	Response  json.RawMessage `json:"response"`
+}
+
+// recording is the file format of a Cassette.
+type recording struct {
+	Messages   map[string]interaction `json:"messages"`
+	Embeddings map[string][]float32   `json:"embeddings"`
+}
+
+// Cassette is an llms.LLMService recording the messages of a chat model and
+// the embeddings of an embedder to a file, and replaying them
+// deterministically.
+//
+// Requests are identified with llms.Fingerprint from the options of the
+// call, so the same code replays the same requests whatever the service.
+// Recordings are written by Save. It is safe for concurrent use.
+type Cassette struct {
+	// LLM and Embedder are the recorded services. They are not used in
+	// ModeReplay.
+	LLM      llms.ChatModel
+	Embedder llms.Embedder
+	Path     string
+	Mode     Mode
+
+	mu        sync.Mutex
+	recording recording
+	changed   bool
+}
+
+// NewCassette loads the recordings of path, if the file exists, for
+// replaying and recording llm and embedder in mode. ModeReplay requires the
+// file. A nil llm or embedder can be neither recorded nor replayed.
+func NewCassette(path string, llm llms.ChatModel, embedder llms.Embedder, mode Mode) (*Cassette, error) {
+	c := &Cassette{
+		LLM:      llm,
+		Embedder: embedder,
+		Path:     path,
+		Mode:     mode,
+		recording: recording{
+			Messages:   make(map[string]interaction),
+			Embeddings: make(map[string][]float32),
+		},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && mode != ModeReplay {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.recording); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// SendMessage replays the recorded response to the message or records it.
+func (c *Cassette) SendMessage(ctx context.Context, prompt string, options ...llms.MessageOptions) (any, error) {
+	var config llms.MessageConfig
+	for _, opt := range options {
+		opt(&config)
+	}
+	key, err := llms.Fingerprint("", config, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Mode != ModeRecord {
+		c.mu.Lock()
+		recorded, ok := c.recording.Messages[key]
+		c.mu.Unlock()
+		if ok {
+			return replayResponse(config.ResponseType, recorded.Response)
+		}
+		if c.Mode == ModeReplay || c.LLM == nil {
+			return nil, fmt.Errorf("%w: prompt key %q, prompt %.80q", ErrNotRecorded, config.PromptKey, prompt)
+		}
+	}
+
+	response, err := c.LLM.SendMessage(ctx, prompt, options...)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recording.Messages[key] = interaction{PromptKey: config.PromptKey, Prompt: prompt, Response: data}
+	c.changed = true
+	return response, nil
+}
+
+// GetEmbedding replays the recorded embeddings of texts and records the
+// missing ones.
+func (c *Cassette) GetEmbedding(ctx context.Context, texts []string, options ...llms.EmbeddingOptions) ([]llms.Embedding, error) {
+	var config llms.EmbeddingConfig
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	embeddings := make([]llms.Embedding, len(texts))
+	keys := make([]string, len(texts))
+	var missing []int
+	c.mu.Lock()
+	for i, text := range texts {
+		key, err := embeddingKey(config, text)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		keys[i] = key
+		if vector, ok := c.recording.Embeddings[key]; ok && c.Mode != ModeRecord {
+			embeddings[i].Vector = vector
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	c.mu.Unlock()
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+	if c.Mode == ModeReplay || c.Embedder == nil {
+		return nil, fmt.Errorf("%w: embedding of %.80q", ErrNotRecorded, texts[missing[0]])
+	}
+
+	missingTexts := make([]string, len(missing))
+	for i, idx := range missing {
+		missingTexts[i] = texts[idx]
+	}
+	retrieved, err := c.Embedder.GetEmbedding(ctx, missingTexts, options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(retrieved) != len(missing) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(retrieved), len(missing))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, idx := range missing {
+		embeddings[idx] = retrieved[i]
+		c.recording.Embeddings[keys[idx]] = retrieved[i].Vector
+	}
+	c.changed = true
+	return embeddings, nil
+}
+
+// StartChat starts a conversation.
+func (c *Cassette) StartChat(options ...llms.MessageOptions) *llms.ChatSession {
+	return llms.NewChatSession(c, options...)
+}
+
+// Save writes the recordings to Path if there are new ones.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.changed {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.recording, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.Path, data, 0o644); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
+
+// embeddingKey identifies the embedding of text.
+func embeddingKey(config llms.EmbeddingConfig, text string) (string, error) {
+	data, err := json.Marshal(struct {
+		Model        string `json:"model"`
+		EmbeddingDim int    `json:"embedding_dim"`
+		Text         string `json:"text"`
+	}{config.Model, config.Dimension, text})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// replayResponse decodes a recorded response the way the providers return
+// it: a string for text responses, a pointer to a new value for structured
+// ones.
+func replayResponse(responseType reflect.Type, data json.RawMessage) (any, error) {
+	if responseType == nil || responseType.Kind() == reflect.String {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return nil, fmt.Errorf("decoding recorded response: %w", err)
+		}
+		return text, nil
+	}
+	return decodeResponse(responseType, data)
+}
@@ -0,0 +1,125 @@
+package llmtest
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+)
+
+type answer struct {
+	Text string `json:"text"`
+}
+
+func TestCassetteRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "testdata", "cassette.json")
+	fake := NewFakeLLM().
+		On("greeting", "Hello.").
+		On("answer", answer{Text: "42"})
+
+	recorder, err := NewCassette(path, fake, fake, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The messages of a chat session are recorded with their history.
+	session := recorder.StartChat()
+	greeting, err := session.SendMessage(ctx, "Hi.", llms.WithPromptKey("greeting"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	structured, err := session.SendMessage(ctx, "What is the answer?",
+		llms.WithPromptKey("answer"), llms.WithResponseType(reflect.TypeOf(answer{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	embeddings, err := recorder.GetEmbedding(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayer, err := NewCassette(path, nil, nil, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session = replayer.StartChat()
+	replayed, err := session.SendMessage(ctx, "Hi.", llms.WithPromptKey("greeting"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != greeting {
+		t.Errorf("replayed %v, recorded %v", replayed, greeting)
+	}
+	replayed, err = session.SendMessage(ctx, "What is the answer?",
+		llms.WithPromptKey("answer"), llms.WithResponseType(reflect.TypeOf(answer{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, structured) {
+		t.Errorf("replayed %#v, recorded %#v", replayed, structured)
+	}
+	replayedEmbeddings, err := replayer.GetEmbedding(ctx, []string{"b", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(replayedEmbeddings[0].Vector, embeddings[1].Vector) || !slices.Equal(replayedEmbeddings[1].Vector, embeddings[0].Vector) {
+		t.Error("replayed embeddings differ from the recorded ones")
+	}
+
+	// A prompt with another history is another request.
+	if _, err := replayer.SendMessage(ctx, "What is the answer?", llms.WithPromptKey("answer")); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("got %v, want ErrNotRecorded", err)
+	}
+	if _, err := replayer.GetEmbedding(ctx, []string{"a", "c"}); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("got %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestCassetteReplayOrRecord(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if _, err := NewCassette(path, nil, nil, ModeReplay); err == nil {
+		t.Error("replaying a missing cassette got no error")
+	}
+
+	fake := NewFakeLLM().OnMatch(".", "Hello.")
+	cassette, err := NewCassette(path, fake, fake, ModeReplayOrRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := cassette.SendMessage(ctx, "Hi."); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cassette.GetEmbedding(ctx, []string{"a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := len(fake.Calls()); calls != 1 {
+		t.Errorf("the service received %d messages, want 1", calls)
+	}
+	if err := cassette.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	cassette, err = NewCassette(path, fake, fake, ModeReplayOrRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cassette.SendMessage(ctx, "Hi."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cassette.SendMessage(ctx, "Bye."); err != nil {
+		t.Fatal(err)
+	}
+	if calls := len(fake.Calls()); calls != 2 {
+		t.Errorf("the service received %d messages, want 2", calls)
+	}
+}
@@ -0,0 +1,243 @@
+// Package llmtest provides LLM services for testing code built on
+// llms.LLMService without network access: FakeLLM answers with scripted
+// responses, and Cassette records the traffic of a real service to a file
+// and replays it.
+//
+// A test of the extraction pipeline can script the responses by prompt key:
+//
+//	llm := llmtest.NewFakeLLM().
+//		On("entity_relationship_extraction", types.Graph{Entities: entities}).
+//		On("entity_relationship_gleaning_done_extraction", services.GleaningStatus{Status: services.Done})
+package llmtest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+)
+
+// ErrNoRule is returned by FakeLLM for a prompt no rule matches.
+var ErrNoRule = errors.New("llmtest: no rule matches the prompt")
+
+// Rule scripts the response to the prompts it matches. A rule without
+// PromptKey and Pattern matches every prompt.
+type Rule struct {
+	// PromptKey matches the prompts formatted from this template, see
+	// llms.WithPromptKey.
+	PromptKey string
+	// Pattern matches the text of the prompts.
+	Pattern *regexp.Regexp
+	// Response is returned to the matched prompts. Values other than
+	// strings are converted to the requested response type through JSON,
+	// and strings are decoded as JSON if a structured response is
+	// requested.
+	Response any
+	// Respond computes the response instead of Response if set.
+	Respond func(prompt string, config llms.MessageConfig) (any, error)
+	// Err is returned instead of a response if set.
+	Err error
+	// Times limits the number of prompts the rule answers. Zero means no
+	// limit.
+	Times int
+
+	used int
+}
+
+func (r *Rule) matches(prompt string, config llms.MessageConfig) bool {
+	if r.Times > 0 && r.used >= r.Times {
+		return false
+	}
+	if r.PromptKey != "" && r.PromptKey != config.PromptKey {
+		return false
+	}
+	return r.Pattern == nil || r.Pattern.MatchString(prompt)
+}
+
+// Call is a message received by FakeLLM.
+type Call struct {
+	Prompt string
+	Config llms.MessageConfig
+}
+
+// FakeLLM is an llms.LLMService answering with scripted responses. The
+// first rule matching a prompt answers it, in the order they were added.
+// Embeddings are derived from a hash of the text, so equal texts get equal
+// vectors. It is safe for concurrent use.
+type FakeLLM struct {
+	Config          *llms.MessageConfig
+	EmbeddingConfig *llms.EmbeddingConfig
+
+	mu    sync.Mutex
+	rules []*Rule
+	calls []Call
+}
+
+// DefaultFakeLLMOptions returns the configuration of FakeLLM.
+func DefaultFakeLLMOptions() *llms.MessageConfig {
+	return &llms.MessageConfig{Model: "fake"}
+}
+
+// DefaultFakeEmbeddingOptions returns the embedding configuration of FakeLLM.
+func DefaultFakeEmbeddingOptions() *llms.EmbeddingConfig {
+	return &llms.EmbeddingConfig{Model: "fake-embedding", Dimension: 32}
+}
+
+// NewFakeLLM creates a FakeLLM without rules.
+func NewFakeLLM(opts ...llms.MessageOptions) *FakeLLM {
+	config := DefaultFakeLLMOptions()
+	for _, opt := range opts {
+		opt(config)
+	}
+	return &FakeLLM{Config: config, EmbeddingConfig: DefaultFakeEmbeddingOptions()}
+}
+
+// Add appends rule to the rules of f.
+func (f *FakeLLM) Add(rule Rule) *FakeLLM {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, &rule)
+	return f
+}
+
+// On answers the prompts formatted from the template promptKey with response.
+func (f *FakeLLM) On(promptKey string, response any) *FakeLLM {
+	return f.Add(Rule{PromptKey: promptKey, Response: response})
+}
+
+// OnMatch answers the prompts matching the regular expression pattern
+// with response. It panics if pattern does not compile.
+func (f *FakeLLM) OnMatch(pattern string, response any) *FakeLLM {
+	return f.Add(Rule{Pattern: regexp.MustCompile(pattern), Response: response})
+}
+
+// Calls returns the messages received so far.
+func (f *FakeLLM) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// SendMessage answers prompt with the response of the first matching rule.
+func (f *FakeLLM) SendMessage(ctx context.Context, prompt string, options ...llms.MessageOptions) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	config := *f.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Prompt: prompt, Config: config})
+	var rule *Rule
+	for _, r := range f.rules {
+		if r.matches(prompt, config) {
+			rule = r
+			rule.used++
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if rule == nil {
+		return nil, fmt.Errorf("%w: prompt key %q, prompt %.80q", ErrNoRule, config.PromptKey, prompt)
+	}
+	if rule.Err != nil {
+		return nil, rule.Err
+	}
+	response := rule.Response
+	if rule.Respond != nil {
+		var err error
+		if response, err = rule.Respond(prompt, config); err != nil {
+			return nil, err
+		}
+	}
+	return convertResponse(config.ResponseType, response)
+}
+
+// GetEmbedding returns a unit vector of Dimension components derived from
+// the hash of each text.
+func (f *FakeLLM) GetEmbedding(ctx context.Context, texts []string, options ...llms.EmbeddingOptions) ([]llms.Embedding, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	config := *f.EmbeddingConfig
+	for _, opt := range options {
+		opt(&config)
+	}
+	embeddings := make([]llms.Embedding, len(texts))
+	for i, text := range texts {
+		embeddings[i].Vector = hashVector(text, config.Dimension)
+	}
+	return embeddings, nil
+}
+
+// StartChat starts a conversation.
+func (f *FakeLLM) StartChat(options ...llms.MessageOptions) *llms.ChatSession {
+	return llms.NewChatSession(f, options...)
+}
+
+// hashVector derives a random unit vector of dim components from the hash
+// of text.
+func hashVector(text string, dim int) []float32 {
+	sum := sha256.Sum256([]byte(text))
+	rng := rand.New(rand.NewPCG(binary.LittleEndian.Uint64(sum[:8]), binary.LittleEndian.Uint64(sum[8:16])))
+	values := make([]float64, dim)
+	var norm float64
+	for i := range values {
+		values[i] = rng.NormFloat64()
+		norm += values[i] * values[i]
+	}
+	norm = math.Sqrt(norm)
+	vector := make([]float32, dim)
+	for i, value := range values {
+		vector[i] = float32(value / norm)
+	}
+	return vector
+}
+
+// convertResponse converts response to responseType the way the providers
+// return it: a string for text responses, a pointer to a new value for
+// structured ones.
+func convertResponse(responseType reflect.Type, response any) (any, error) {
+	if responseType == nil || responseType.Kind() == reflect.String {
+		text, ok := response.(string)
+		if !ok {
+			data, err := json.Marshal(response)
+			if err != nil {
+				return nil, err
+			}
+			text = string(data)
+		}
+		return text, nil
+	}
+
+	data, ok := response.(string)
+	if !ok {
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+		data = string(encoded)
+	}
+	return decodeResponse(responseType, []byte(data))
+}
+
+// decodeResponse decodes data into a pointer to a new value of responseType.
+func decodeResponse(responseType reflect.Type, data []byte) (any, error) {
+	value := reflect.New(responseType).Interface()
+	if err := json.Unmarshal(data, value); err != nil {
+		return nil, fmt.Errorf("decoding %s response: %w", responseType, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,61 @@
+package llmtest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+)
+
+func TestFakeLLMRules(t *testing.T) {
+	ctx := context.Background()
+	errRule := errors.New("scripted error")
+	fake := NewFakeLLM().
+		Add(Rule{PromptKey: "answer", Response: `{"text":"first"}`, Times: 1}).
+		On("answer", answer{Text: "next"}).
+		Add(Rule{PromptKey: "fail", Err: errRule}).
+		OnMatch("(?i)hello", "Hi.")
+
+	structured := llms.WithResponseType(reflect.TypeOf(answer{}))
+	for _, want := range []string{"first", "next", "next"} {
+		response, err := fake.SendMessage(ctx, "?", llms.WithPromptKey("answer"), structured)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := response.(*answer).Text; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if response, err := fake.SendMessage(ctx, "Hello there."); err != nil || response != "Hi." {
+		t.Errorf("got %v, %v, want Hi.", response, err)
+	}
+	if response, err := fake.SendMessage(ctx, "?", llms.WithPromptKey("answer")); err != nil || response != `{"text":"next"}` {
+		t.Errorf("got %v, %v, want the JSON of the response", response, err)
+	}
+	if _, err := fake.SendMessage(ctx, "?", llms.WithPromptKey("fail")); !errors.Is(err, errRule) {
+		t.Errorf("got %v, want the scripted error", err)
+	}
+	if _, err := fake.SendMessage(ctx, "Bye."); !errors.Is(err, ErrNoRule) {
+		t.Errorf("got %v, want ErrNoRule", err)
+	}
+	if calls := fake.Calls(); len(calls) != 7 || calls[3].Prompt != "Hello there." {
+		t.Errorf("got calls %v", calls)
+	}
+}
+
+func TestFakeLLMEmbedding(t *testing.T) {
+	fake := NewFakeLLM()
+	embeddings, err := fake.GetEmbedding(context.Background(), []string{"a", "b", "a"}, llms.WithEmbeddingDim(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(embeddings[0].Vector) != 8 {
+		t.Fatalf("got %d dimensions, want 8", len(embeddings[0].Vector))
+	}
+	if !slices.Equal(embeddings[0].Vector, embeddings[2].Vector) || slices.Equal(embeddings[0].Vector, embeddings[1].Vector) {
+		t.Error("equal texts must have equal embeddings and different texts different ones")
+	}
+}
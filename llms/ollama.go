@@ -0,0 +1,207 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms/jsonschema"
+)
+
+// OllamaLLMService implements the ChatModel interface for a local Ollama server.
+type OllamaLLMService struct {
+	Config     *MessageConfig
+	MaxRetries int
+	Client     *http.Client
+	// KeepAlive controls how long the model stays loaded after a request,
+	// e.g. "10m" or "-1" to keep it loaded. Empty uses the server default.
+	KeepAlive string
+	// NumCtx is the context window size in tokens. The server default is
+	// too small for the extraction prompts, which would be silently truncated.
+	NumCtx int
+}
+
+func DefaultOllamaLLMOptions() *MessageConfig {
+	return &MessageConfig{
+		Model:        "llama3.1",
+		MaxTokens:    8000,
+		ResponseType: reflect.TypeOf(""),
+		BaseURL:      "http://localhost:11434",
+	}
+}
+
+// NewOllamaLLMService initializes an Ollama-based LLM service.
+func NewOllamaLLMService(ctx context.Context, options ...MessageOptions) (*OllamaLLMService, error) {
+	config := DefaultOllamaLLMOptions()
+	for _, opt := range options {
+		opt(config)
+	}
+	if config.BaseURL == "" {
+		return nil, errors.New("base url is required")
+	}
+	return &OllamaLLMService{
+		Config:     config,
+		MaxRetries: 3,
+		Client:     http.DefaultClient,
+		NumCtx:     16384,
+	}, nil
+}
+
+type ollamaOptions struct {
+	NumCtx      int     `json:"num_ctx,omitempty"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+	Temperature float64 `json:"temperature"`
+}
+
+type ollamaChatRequest struct {
+	Model     string             `json:"model"`
+	Messages  []openAIMessage    `json:"messages"`
+	Stream    bool               `json:"stream"`
+	Format    *jsonschema.Schema `json:"format,omitempty"`
+	KeepAlive string             `json:"keep_alive,omitempty"`
+	Options   ollamaOptions      `json:"options"`
+}
+
+type ollamaChatResponse struct {
+	Message         openAIMessage `json:"message"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+// SendMessage sends a message to the language model and receives a response.
+func (o *OllamaLLMService) SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error) {
+	config := *o.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	messages, err := openAIMessages(config, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	request := ollamaChatRequest{
+		Model:     config.Model,
+		Messages:  messages,
+		KeepAlive: o.KeepAlive,
+		Options: ollamaOptions{
+			NumCtx:     o.NumCtx,
+			NumPredict: config.MaxTokens,
+		},
+	}
+	switch config.ResponseType.Kind() {
+	case reflect.String:
+	case reflect.Slice, reflect.Array, reflect.Struct:
+		schema, err := jsonschema.GenerateSchemaFromType(config.ResponseType)
+		if err != nil {
+			return nil, err
+		}
+		request.Format = schema
+	default:
+		return nil, errors.New("unsupported type")
+	}
+
+	var response ollamaChatResponse
+	if err := Retry(ctx, retryConfig(o.MaxRetries), func() error {
+		return postJSON(ctx, o.Client, joinURL(config.BaseURL, "/api/chat"), nil, request, &response)
+	}); err != nil {
+		return nil, err
+	}
+	RecordUsage(ctx, config.Model, Usage{
+		PromptTokens:     response.PromptEvalCount,
+		CompletionTokens: response.EvalCount,
+	})
+	output := response.Message.Content
+	if config.ResponseType.Kind() == reflect.String {
+		return output, nil
+	}
+	return unmarshalResponse(config.ResponseType, output)
+}
+
+// StartChat starts a conversation.
+func (o *OllamaLLMService) StartChat(options ...MessageOptions) *ChatSession {
+	return NewChatSession(o, options...)
+}
+
+func (o *OllamaLLMService) messageConfig() MessageConfig {
+	return *o.Config
+}
+
+// OllamaEmbedder implements the Embedder interface for a local Ollama server.
+type OllamaEmbedder struct {
+	Config     *EmbeddingConfig
+	MaxRetries int
+	Client     *http.Client
+	// KeepAlive controls how long the model stays loaded after a request.
+	KeepAlive string
+}
+
+func DefaultOllamaEmbeddingOptions() *EmbeddingConfig {
+	return &EmbeddingConfig{
+		Model:     "nomic-embed-text",
+		BatchSize: 512,
+		BaseURL:   "http://localhost:11434",
+	}
+}
+
+// NewOllamaEmbedder initializes an Ollama-based embedder.
+func NewOllamaEmbedder(ctx context.Context, options ...EmbeddingOptions) (*OllamaEmbedder, error) {
+	config := DefaultOllamaEmbeddingOptions()
+	for _, opt := range options {
+		opt(config)
+	}
+	if config.BaseURL == "" {
+		return nil, errors.New("base url is required")
+	}
+	return &OllamaEmbedder{
+		Config:     config,
+		MaxRetries: 3,
+		Client:     http.DefaultClient,
+	}, nil
+}
+
+type ollamaEmbedRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+	KeepAlive  string   `json:"keep_alive,omitempty"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings      [][]float32 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+}
+
+// GetEmbedding retrieves embeddings for the given texts.
+func (o *OllamaEmbedder) GetEmbedding(ctx context.Context, texts []string, options ...EmbeddingOptions) ([]Embedding, error) {
+	config := *o.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	return embedInBatches(ctx, config, texts, func(ctx context.Context, batch []string) ([]Embedding, error) {
+		request := ollamaEmbedRequest{
+			Model:      config.Model,
+			Input:      batch,
+			Dimensions: config.Dimension,
+			KeepAlive:  o.KeepAlive,
+		}
+		var response ollamaEmbedResponse
+		if err := Retry(ctx, retryConfig(o.MaxRetries), func() error {
+			return postJSON(ctx, o.Client, joinURL(config.BaseURL, "/api/embed"), nil, request, &response)
+		}); err != nil {
+			return nil, err
+		}
+		RecordUsage(ctx, config.Model, Usage{EmbeddingTokens: response.PromptEvalCount})
+		embeddings := make([]Embedding, len(response.Embeddings))
+		for i, vector := range response.Embeddings {
+			embeddings[i].Vector = vector
+		}
+		return embeddings, nil
+	})
+}
+
+func (o *OllamaEmbedder) embeddingConfig() EmbeddingConfig {
+	return *o.Config
+}
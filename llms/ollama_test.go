@@ -0,0 +1,82 @@
+package llms
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestOllamaSendMessage(t *testing.T) {
+	server := newTestServer(t, func(body map[string]any) (int, any) {
+		content := "Hello."
+		if body["format"] != nil {
+			content = `{"answer":"yes"}`
+		}
+		return http.StatusOK, map[string]any{
+			"message":           map[string]any{"role": "assistant", "content": content},
+			"prompt_eval_count": 7,
+			"eval_count":        3,
+		}
+	})
+	llm, err := NewOllamaLLMService(context.Background(), WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm.KeepAlive = "10m"
+
+	response, err := llm.SendMessage(context.Background(), "Hi.", WithMaxTokens(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "Hello." {
+		t.Errorf("got %v, want Hello.", response)
+	}
+	request := server.lastRequest(t)
+	if request.Path != "/api/chat" || request.Body["stream"] != false || request.Body["keep_alive"] != "10m" {
+		t.Errorf("got request %s %v", request.Path, request.Body)
+	}
+	if numCtx, numPredict := jsonPath(request.Body, "options", "num_ctx"), jsonPath(request.Body, "options", "num_predict"); numCtx != 16384.0 || numPredict != 100.0 {
+		t.Errorf("got num_ctx %v and num_predict %v", numCtx, numPredict)
+	}
+
+	response, err = llm.SendMessage(context.Background(), "Answer.", WithResponseType(reflect.TypeOf(testAnswer{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&testAnswer{Answer: "yes"}); !reflect.DeepEqual(response, want) {
+		t.Errorf("got %#v, want %#v", response, want)
+	}
+	if format := server.lastRequest(t).Body["format"]; jsonPath(format, "type") != "object" || jsonPath(format, "properties", "answer", "type") != "string" {
+		t.Errorf("got format %v, want the schema of the response", format)
+	}
+}
+
+func TestOllamaEmbedder(t *testing.T) {
+	server := newTestServer(t, func(body map[string]any) (int, any) {
+		var embeddings [][]float32
+		for _, text := range body["input"].([]any) {
+			embeddings = append(embeddings, []float32{float32(len(text.(string))), 1, 0})
+		}
+		return http.StatusOK, map[string]any{"embeddings": embeddings, "prompt_eval_count": 2}
+	})
+	embedder, err := NewOllamaEmbedder(context.Background(), WithEmbeddingBaseURL(server.URL), WithEmbeddingDim(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	embeddings, err := embedder.GetEmbedding(context.Background(), []string{"a", "bb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(embeddings) != 2 || embeddings[0].Vector[0] != 1 || embeddings[1].Vector[0] != 2 {
+		t.Errorf("got %v", embeddings)
+	}
+	if request := server.lastRequest(t); request.Path != "/api/embed" || request.Body["dimensions"] != 3.0 {
+		t.Errorf("got request %s %v", request.Path, request.Body)
+	}
+
+	// The server ignoring the requested dimension is reported.
+	if _, err := embedder.GetEmbedding(context.Background(), []string{"a"}, WithEmbeddingDim(8)); err == nil {
+		t.Error("got no error for embeddings of another dimension")
+	}
+}
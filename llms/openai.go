@@ -0,0 +1,335 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms/jsonschema"
+)
+
+// OpenAILLMService implements the ChatModel interface for the OpenAI Chat
+// Completions API and compatible servers.
+type OpenAILLMService struct {
+	Config     *MessageConfig
+	APIKey     string
+	MaxRetries int
+	Client     *http.Client
+	// Header holds additional headers sent with every request, e.g. the
+	// api-key header of Azure deployments.
+	Header http.Header
+}
+
+func DefaultOpenAILLMOptions() *MessageConfig {
+	return &MessageConfig{
+		Model:        "gpt-4o-mini",
+		MaxTokens:    8000,
+		ResponseType: reflect.TypeOf(""),
+		BaseURL:      "https://api.openai.com/v1",
+	}
+}
+
+// NewOpenAILLMService initializes an OpenAI-based LLM service. Use
+// WithBaseURL to target compatible servers such as vLLM, llama.cpp or LM Studio.
+func NewOpenAILLMService(ctx context.Context, apiKey string, options ...MessageOptions) (*OpenAILLMService, error) {
+	config := DefaultOpenAILLMOptions()
+	for _, opt := range options {
+		opt(config)
+	}
+	if config.BaseURL == "" {
+		return nil, errors.New("base url is required")
+	}
+	return &OpenAILLMService{
+		Config:     config,
+		APIKey:     apiKey,
+		MaxRetries: 3,
+		Client:     http.DefaultClient,
+	}, nil
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// openAIItemsProperty wraps non-object responses, as the root of a
+// structured output schema must be an object.
+const openAIItemsProperty = "items"
+
+type openAIJSONSchema struct {
+	Name   string             `json:"name"`
+	Schema *jsonschema.Schema `json:"schema"`
+	Strict bool               `json:"strict"`
+}
+
+type openAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *openAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []openAIMessage       `json:"messages"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	Temperature    float64               `json:"temperature"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage openAIUsage `json:"usage"`
+}
+
+// SendMessage sends a message to the language model and receives a response.
+func (o *OpenAILLMService) SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error) {
+	config := *o.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	messages, err := openAIMessages(config, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	request := openAIChatRequest{
+		Model:     config.Model,
+		Messages:  messages,
+		MaxTokens: config.MaxTokens,
+	}
+	wrapped := false
+	switch config.ResponseType.Kind() {
+	case reflect.String:
+	case reflect.Slice, reflect.Array, reflect.Struct:
+		schema, err := jsonschema.GenerateSchemaFromType(config.ResponseType)
+		if err != nil {
+			return nil, err
+		}
+		if schema.Type != "object" {
+			schema = &jsonschema.Schema{
+				Type:       "object",
+				Properties: map[string]*jsonschema.Schema{openAIItemsProperty: schema},
+			}
+			wrapped = true
+		}
+		request.ResponseFormat = &openAIResponseFormat{
+			Type: "json_schema",
+			JSONSchema: &openAIJSONSchema{
+				Name:   schemaName(config.ResponseType),
+				Schema: openAIStrictSchema(schema),
+				Strict: true,
+			},
+		}
+	default:
+		return nil, errors.New("unsupported type")
+	}
+
+	var response openAIChatResponse
+	if err := Retry(ctx, retryConfig(o.MaxRetries), func() error {
+		return postJSON(ctx, o.Client, joinURL(config.BaseURL, "/chat/completions"), openAIHeader(o.Header, o.APIKey), request, &response)
+	}); err != nil {
+		return nil, err
+	}
+	RecordUsage(ctx, config.Model, Usage{
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+	})
+	if len(response.Choices) == 0 {
+		return nil, errors.New("no choices in response")
+	}
+	output := response.Choices[0].Message.Content
+	if config.ResponseType.Kind() == reflect.String {
+		return output, nil
+	}
+	if wrapped {
+		var items map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(output), &items); err != nil {
+			return nil, err
+		}
+		output = string(items[openAIItemsProperty])
+	}
+	return unmarshalResponse(config.ResponseType, output)
+}
+
+// openAIStrictSchema returns a copy of schema meeting the requirements of
+// strict structured outputs: objects list all their properties as required
+// and allow no others, and only strings have a format.
+func openAIStrictSchema(schema *jsonschema.Schema) *jsonschema.Schema {
+	if schema == nil {
+		return nil
+	}
+	strict := *schema
+	if strict.Type != "string" {
+		strict.Format = ""
+	}
+	strict.Items = openAIStrictSchema(schema.Items)
+	if strict.Type == "object" {
+		noAdditional := false
+		strict.AdditionalProperties = &noAdditional
+		strict.Properties = make(map[string]*jsonschema.Schema, len(schema.Properties))
+		strict.Required = make([]string, 0, len(schema.Properties))
+		for name, property := range schema.Properties {
+			strict.Properties[name] = openAIStrictSchema(property)
+			strict.Required = append(strict.Required, name)
+		}
+		slices.Sort(strict.Required)
+	}
+	return &strict
+}
+
+// openAIMessages converts the system prompt, the ChatMessage history and
+// prompt to chat messages.
+func openAIMessages(config MessageConfig, prompt string) ([]openAIMessage, error) {
+	var messages []openAIMessage
+	if config.SystemPrompt != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: config.SystemPrompt})
+	}
+	for _, message := range config.HistoryMessages {
+		chatMessage, ok := message.(ChatMessage)
+		if !ok {
+			return nil, fmt.Errorf("unsupported history message type %T", message)
+		}
+		messages = append(messages, openAIMessage{Role: chatMessage.Role, Content: chatMessage.Content})
+	}
+	return append(messages, openAIMessage{Role: RoleUser, Content: prompt}), nil
+}
+
+// joinURL appends path to baseURL.
+func joinURL(baseURL, path string) string {
+	return strings.TrimSuffix(baseURL, "/") + path
+}
+
+// openAIHeader returns extra with the bearer authorization of apiKey.
+func openAIHeader(extra http.Header, apiKey string) http.Header {
+	header := extra.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if apiKey != "" {
+		header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return header
+}
+
+// schemaName returns a name for the schema of typ, as required by some
+// structured output APIs.
+func schemaName(typ reflect.Type) string {
+	if typ.Name() != "" {
+		return typ.Name()
+	}
+	return "response"
+}
+
+// StartChat starts a conversation.
+func (o *OpenAILLMService) StartChat(options ...MessageOptions) *ChatSession {
+	return NewChatSession(o, options...)
+}
+
+func (o *OpenAILLMService) messageConfig() MessageConfig {
+	return *o.Config
+}
+
+// OpenAIEmbedder implements the Embedder interface for the OpenAI Embeddings
+// API and compatible servers.
+type OpenAIEmbedder struct {
+	Config     *EmbeddingConfig
+	APIKey     string
+	MaxRetries int
+	Client     *http.Client
+	// Header holds additional headers sent with every request.
+	Header http.Header
+}
+
+func DefaultOpenAIEmbeddingOptions() *EmbeddingConfig {
+	return &EmbeddingConfig{
+		Model:     "text-embedding-3-small",
+		BatchSize: 2048,
+		// The API accepts 300k tokens per request, the estimate keeps a margin.
+		MaxBatchTokens:       200000,
+		MaxConcurrentBatches: 4,
+		BaseURL:              "https://api.openai.com/v1",
+	}
+}
+
+// NewOpenAIEmbedder initializes an OpenAI-based embedder. Use
+// WithEmbeddingBaseURL to target compatible servers.
+func NewOpenAIEmbedder(ctx context.Context, apiKey string, options ...EmbeddingOptions) (*OpenAIEmbedder, error) {
+	config := DefaultOpenAIEmbeddingOptions()
+	for _, opt := range options {
+		opt(config)
+	}
+	if config.BaseURL == "" {
+		return nil, errors.New("base url is required")
+	}
+	return &OpenAIEmbedder{
+		Config:     config,
+		APIKey:     apiKey,
+		MaxRetries: 3,
+		Client:     http.DefaultClient,
+	}, nil
+}
+
+type openAIEmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+	Usage openAIUsage `json:"usage"`
+}
+
+// GetEmbedding retrieves embeddings for the given texts.
+func (o *OpenAIEmbedder) GetEmbedding(ctx context.Context, texts []string, options ...EmbeddingOptions) ([]Embedding, error) {
+	config := *o.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	return embedInBatches(ctx, config, texts, func(ctx context.Context, batch []string) ([]Embedding, error) {
+		request := openAIEmbeddingRequest{
+			Model:      config.Model,
+			Input:      batch,
+			Dimensions: config.Dimension,
+		}
+		var response openAIEmbeddingResponse
+		if err := Retry(ctx, retryConfig(o.MaxRetries), func() error {
+			return postJSON(ctx, o.Client, joinURL(config.BaseURL, "/embeddings"), openAIHeader(o.Header, o.APIKey), request, &response)
+		}); err != nil {
+			return nil, err
+		}
+		RecordUsage(ctx, config.Model, Usage{EmbeddingTokens: response.Usage.PromptTokens})
+		if len(response.Data) != len(batch) {
+			return nil, fmt.Errorf("got %d embeddings for %d texts", len(response.Data), len(batch))
+		}
+		embeddings := make([]Embedding, len(batch))
+		for _, data := range response.Data {
+			if data.Index < 0 || data.Index >= len(embeddings) {
+				return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+			}
+			embeddings[data.Index].Vector = data.Embedding
+		}
+		return embeddings, nil
+	})
+}
+
+func (o *OpenAIEmbedder) embeddingConfig() EmbeddingConfig {
+	return *o.Config
+}
@@ -0,0 +1,172 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// openAIChatReply is a chat completion answering content.
+func openAIChatReply(content string) map[string]any {
+	return map[string]any{
+		"choices": []any{map[string]any{
+			"message":       map[string]any{"role": "assistant", "content": content},
+			"finish_reason": "stop",
+		}},
+		"usage": map[string]any{"prompt_tokens": 10, "completion_tokens": 5},
+	}
+}
+
+func TestOpenAISendMessage(t *testing.T) {
+	server := newTestServer(t, func(body map[string]any) (int, any) {
+		return http.StatusOK, openAIChatReply("Hello.")
+	})
+	llm, err := NewOpenAILLMService(context.Background(), "key", WithBaseURL(server.URL+"/v1/"), WithModel("model"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewUsageTracker()
+	ctx := WithUsageTracker(context.Background(), tracker)
+
+	response, err := llm.SendMessage(ctx, "Hi.",
+		WithSystemPrompt("Be brief."),
+		WithHistoryMessges([]Message{ChatMessage{Role: RoleUser, Content: "Before."}, ChatMessage{Role: RoleAssistant, Content: "Ok."}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "Hello." {
+		t.Errorf("got %v, want Hello.", response)
+	}
+
+	request := server.lastRequest(t)
+	if request.Path != "/v1/chat/completions" {
+		t.Errorf("request sent to %s", request.Path)
+	}
+	if got := request.Header.Get("Authorization"); got != "Bearer key" {
+		t.Errorf("got authorization %q", got)
+	}
+	var roles []any
+	for _, message := range request.Body["messages"].([]any) {
+		roles = append(roles, jsonPath(message, "role"))
+	}
+	if want := []any{"system", RoleUser, RoleAssistant, RoleUser}; !slices.Equal(roles, want) {
+		t.Errorf("got roles %v, want %v", roles, want)
+	}
+	if request.Body["model"] != "model" || request.Body["response_format"] != nil {
+		t.Errorf("got request %v", request.Body)
+	}
+	if usage := tracker.Report(nil).Total; usage.PromptTokens != 10 || usage.CompletionTokens != 5 {
+		t.Errorf("recorded usage %+v", usage)
+	}
+}
+
+func TestOpenAIStructuredOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		responseType reflect.Type
+		reply        string
+		want         any
+	}{
+		{"object", reflect.TypeOf(testAnswer{}), `{"answer":"yes","score":1}`, &testAnswer{Answer: "yes", Score: 1}},
+		{"array", reflect.TypeOf([]testAnswer{}), `{"items":[{"answer":"yes","score":0}]}`, &[]testAnswer{{Answer: "yes"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, func(body map[string]any) (int, any) {
+				return http.StatusOK, openAIChatReply(test.reply)
+			})
+			llm, err := NewOpenAILLMService(context.Background(), "key", WithBaseURL(server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := llm.SendMessage(context.Background(), "Answer.", WithResponseType(test.responseType))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(response, test.want) {
+				t.Errorf("got %#v, want %#v", response, test.want)
+			}
+
+			format := server.lastRequest(t).Body["response_format"]
+			if jsonPath(format, "type") != "json_schema" || jsonPath(format, "json_schema", "strict") != true {
+				t.Fatalf("got response format %v, want a strict json schema", format)
+			}
+			// The root is an object, and every object requires all its
+			// properties and no others.
+			schema := jsonPath(format, "json_schema", "schema")
+			if test.name == "array" {
+				if jsonPath(schema, "type") != "object" || !reflect.DeepEqual(jsonPath(schema, "required"), []any{"items"}) {
+					t.Fatalf("array root not wrapped: %v", schema)
+				}
+				schema = jsonPath(schema, "properties", "items", "items")
+			}
+			if jsonPath(schema, "additionalProperties") != false {
+				t.Errorf("got additionalProperties %v, want false", jsonPath(schema, "additionalProperties"))
+			}
+			if required := jsonPath(schema, "required"); !reflect.DeepEqual(required, []any{"answer", "score"}) {
+				t.Errorf("got required %v, want every property", required)
+			}
+			if format := jsonPath(schema, "properties", "score", "format"); format != nil {
+				t.Errorf("number has the format %v", format)
+			}
+		})
+	}
+}
+
+func TestOpenAIError(t *testing.T) {
+	server := newTestServer(t, func(body map[string]any) (int, any) {
+		return http.StatusBadRequest, map[string]any{"error": map[string]any{"message": "invalid schema"}}
+	})
+	llm, err := NewOpenAILLMService(context.Background(), "key", WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = llm.SendMessage(context.Background(), "Hi.")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got %v, want an APIError with status 400", err)
+	}
+	if n := len(server.Requests()); n != 1 {
+		t.Errorf("client error sent %d times, want 1", n)
+	}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	server := newTestServer(t, func(body map[string]any) (int, any) {
+		// Answer in reverse order, the embeddings are placed by index.
+		input := body["input"].([]any)
+		var data []any
+		for i := len(input) - 1; i >= 0; i-- {
+			data = append(data, map[string]any{"index": i, "embedding": []float32{float32(len(input[i].(string))), 1}})
+		}
+		return http.StatusOK, map[string]any{"data": data, "usage": map[string]any{"prompt_tokens": 3}}
+	})
+	embedder, err := NewOpenAIEmbedder(context.Background(), "key",
+		WithEmbeddingBaseURL(server.URL), WithEmbeddingDim(2), WithEmbeddingBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	embeddings, err := embedder.GetEmbedding(context.Background(), []string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, embedding := range embeddings {
+		if embedding.Vector[0] != float32(i+1) {
+			t.Errorf("embedding %d is %v", i, embedding.Vector)
+		}
+	}
+
+	requests := server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2 batches", len(requests))
+	}
+	for _, request := range requests {
+		if request.Path != "/embeddings" || request.Body["dimensions"] != 2.0 {
+			t.Errorf("got request %s %v", request.Path, request.Body)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package llms
+
+import (
+	"context"
+	"iter"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitConfig configures a RateLimitedLLMService or a
+// RateLimitedEmbedder. Zero fields are unlimited.
+type RateLimitConfig struct {
+	// MaxConcurrent is the maximum number of requests in flight.
+	MaxConcurrent int
+	// RequestsPerMinute is the maximum request rate.
+	RequestsPerMinute int
+	// TokensPerMinute is the maximum rate of prompt and embedded tokens,
+	// estimated from the text length.
+	TokensPerMinute int
+}
+
+// rateLimiter holds the budgets of a RateLimitConfig.
+type rateLimiter struct {
+	slots    chan struct{}
+	requests *rate.Limiter
+	tokens   *rate.Limiter
+}
+
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	r := &rateLimiter{}
+	if config.MaxConcurrent > 0 {
+		r.slots = make(chan struct{}, config.MaxConcurrent)
+	}
+	if config.RequestsPerMinute > 0 {
+		r.requests = rate.NewLimiter(rate.Limit(float64(config.RequestsPerMinute)/60), 1)
+	}
+	if config.TokensPerMinute > 0 {
+		r.tokens = rate.NewLimiter(rate.Limit(float64(config.TokensPerMinute)/60), config.TokensPerMinute)
+	}
+	return r
+}
+
+// RateLimitedLLMService limits the concurrency and rate of the requests of
+// a ChatModel. It is safe for concurrent use, and callers block until
+// their request fits in the budgets or their context is done.
+type RateLimitedLLMService struct {
+	LLM ChatModel
+
+	limiter *rateLimiter
+}
+
+// NewRateLimitedLLMService wraps llm to limit its requests according to config.
+func NewRateLimitedLLMService(llm ChatModel, config RateLimitConfig) *RateLimitedLLMService {
+	return &RateLimitedLLMService{LLM: llm, limiter: newRateLimiter(config)}
+}
+
+// SendMessage sends a message once the limits allow it.
+func (r *RateLimitedLLMService) SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error) {
+	release, err := r.limiter.acquire(ctx, promptTokens(prompt, options))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return r.LLM.SendMessage(ctx, prompt, options...)
+}
+
+// promptTokens estimates the tokens of a request: the prompt, the system
+// prompt and the history.
+func promptTokens(prompt string, options []MessageOptions) int {
+	var config MessageConfig
+	for _, opt := range options {
+		opt(&config)
+	}
+	texts := []string{prompt, config.SystemPrompt}
+	for _, message := range config.HistoryMessages {
+		if chatMessage, ok := message.(ChatMessage); ok {
+			texts = append(texts, chatMessage.Content)
+		}
+	}
+	return estimateTokens(texts)
+}
+
+// acquire waits until a slot is free and a request of tokens tokens fits
+// in the budgets. The returned function frees the slot.
+func (r *rateLimiter) acquire(ctx context.Context, tokens int) (func(), error) {
+	// Take the slot first, so that requests queued behind MaxConcurrent do
+	// not use up the rate budgets and then fire all at once.
+	release := func() {}
+	if r.slots != nil {
+		select {
+		case r.slots <- struct{}{}:
+			release = func() { <-r.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if r.requests != nil {
+		if err := r.requests.Wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	if r.tokens != nil && tokens > 0 {
+		// A request larger than the budget of a minute waits for the full budget.
+		if err := r.tokens.WaitN(ctx, min(tokens, r.tokens.Burst())); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// SendMessageStream streams a response once the limits allow it. The
+// request stays in flight until the stream ends.
+func (r *RateLimitedLLMService) SendMessageStream(ctx context.Context, prompt string, options ...MessageOptions) iter.Seq2[StreamChunk, error] {
+	return func(yield func(StreamChunk, error) bool) {
+		release, err := r.limiter.acquire(ctx, promptTokens(prompt, options))
+		if err != nil {
+			yield(StreamChunk{}, err)
+			return
+		}
+		defer release()
+		for chunk, err := range Stream(ctx, r.LLM, prompt, options...) {
+			if !yield(chunk, err) {
+				return
+			}
+		}
+	}
+}
+
+// StartChat starts a conversation.
+func (r *RateLimitedLLMService) StartChat(options ...MessageOptions) *ChatSession {
+	return NewChatSession(r, options...)
+}
+
+func (r *RateLimitedLLMService) messageConfig() MessageConfig {
+	return baseConfig(r.LLM)
+}
+
+// RateLimitedEmbedder limits the concurrency and rate of the requests of an
+// Embedder, like RateLimitedLLMService.
+type RateLimitedEmbedder struct {
+	Embedder Embedder
+
+	limiter *rateLimiter
+}
+
+// NewRateLimitedEmbedder wraps embedder to limit its requests according to config.
+func NewRateLimitedEmbedder(embedder Embedder, config RateLimitConfig) *RateLimitedEmbedder {
+	return &RateLimitedEmbedder{Embedder: embedder, limiter: newRateLimiter(config)}
+}
+
+// GetEmbedding retrieves embeddings once the limits allow it.
+func (r *RateLimitedEmbedder) GetEmbedding(ctx context.Context, texts []string, options ...EmbeddingOptions) ([]Embedding, error) {
+	release, err := r.limiter.acquire(ctx, estimateTokens(texts))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return r.Embedder.GetEmbedding(ctx, texts, options...)
+}
+
+func (r *RateLimitedEmbedder) embeddingConfig() EmbeddingConfig {
+	return baseEmbeddingConfig(r.Embedder)
+}
@@ -0,0 +1,39 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSlotBeforeBudgets(t *testing.T) {
+	r := newRateLimiter(RateLimitConfig{MaxConcurrent: 1, TokensPerMinute: 60})
+	release, err := r.acquire(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A request waiting for the slot does not use up the token budget.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.acquire(ctx, 50); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if tokens := r.tokens.Tokens(); tokens < 49 {
+		t.Errorf("%.0f tokens left, want the 50 not used by the first request", tokens)
+	}
+
+	// The slot is freed by release, and by a failed wait on the budgets.
+	release()
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.acquire(ctx, 60); err == nil {
+		t.Fatal("got no error for a request over the token budget")
+	}
+	release, err = r.acquire(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
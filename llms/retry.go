@@ -0,0 +1,216 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryConfig configures the retries of failed requests.
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff. A longer delay requested by
+	// the server is still honored.
+	MaxBackoff time.Duration
+	// Multiplier is the growth factor of the backoff.
+	Multiplier float64
+	// Jitter is the fraction of each backoff which is randomized, so that
+	// concurrent requests failing together do not retry together.
+	Jitter float64
+}
+
+// DefaultRetryConfig returns the retry configuration used by the providers.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxRetries:     3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+}
+
+// retryConfig returns the default configuration with maxRetries retries.
+func retryConfig(maxRetries int) RetryConfig {
+	config := DefaultRetryConfig()
+	config.MaxRetries = maxRetries
+	return config
+}
+
+// Retry calls fn until it succeeds, fails with an error which is not
+// retryable or config.MaxRetries retries have failed. Retries wait for an
+// exponentially growing, jittered backoff or the delay requested by the
+// server, whichever is longer.
+func Retry(ctx context.Context, config RetryConfig, fn func() error) error {
+	backoff := config.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= config.MaxRetries || ctx.Err() != nil || !IsRetryable(err) {
+			if attempt > 0 {
+				return fmt.Errorf("after %d attempts: %w", attempt+1, err)
+			}
+			return err
+		}
+
+		delay := time.Duration(float64(backoff) * (1 - config.Jitter*rand.Float64()))
+		if retryAfter := RetryAfter(err); retryAfter > delay {
+			delay = retryAfter
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(time.Duration(float64(backoff)*config.Multiplier), config.MaxBackoff)
+	}
+}
+
+// IsRetryable reports whether err is transient: rate limiting, server
+// errors, timeouts and dropped connections. Canceled requests and client
+// errors such as invalid arguments are permanent.
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.StatusCode)
+	}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return retryableStatus(googleErr.Code)
+	}
+	var httpErr interface{ HTTPCode() int }
+	if errors.As(err, &httpErr) && httpErr.HTTPCode() > 0 {
+		return retryableStatus(httpErr.HTTPCode())
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted, codes.Internal:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout ||
+		code == http.StatusTooManyRequests ||
+		code >= http.StatusInternalServerError
+}
+
+// RetryAfter returns the delay requested by the server with err, from a
+// Retry-After header or a gRPC RetryInfo detail. It returns 0 if there is none.
+func RetryAfter(err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter
+	}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return parseRetryAfter(googleErr.Header.Get("Retry-After"))
+	}
+	if s, ok := status.FromError(err); ok {
+		for _, detail := range s.Details() {
+			if info, ok := detail.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+				return info.RetryDelay.AsDuration()
+			}
+		}
+	}
+	return 0
+}
+
+// RetryLLMService retries the failed requests of a ChatModel. The
+// providers of this package already retry up to their MaxRetries; use it
+// for other implementations.
+type RetryLLMService struct {
+	LLM    ChatModel
+	Config RetryConfig
+}
+
+// NewRetryLLMService wraps llm to retry its failed requests.
+func NewRetryLLMService(llm ChatModel, config RetryConfig) *RetryLLMService {
+	return &RetryLLMService{LLM: llm, Config: config}
+}
+
+// SendMessage sends a message, retrying transient failures.
+func (r *RetryLLMService) SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error) {
+	var response any
+	err := Retry(ctx, r.Config, func() (err error) {
+		response, err = r.LLM.SendMessage(ctx, prompt, options...)
+		return err
+	})
+	return response, err
+}
+
+// SendMessageStream streams the response of the wrapped service. Streams
+// are not retried.
+func (r *RetryLLMService) SendMessageStream(ctx context.Context, prompt string, options ...MessageOptions) iter.Seq2[StreamChunk, error] {
+	return Stream(ctx, r.LLM, prompt, options...)
+}
+
+// StartChat starts a conversation.
+func (r *RetryLLMService) StartChat(options ...MessageOptions) *ChatSession {
+	return NewChatSession(r, options...)
+}
+
+func (r *RetryLLMService) messageConfig() MessageConfig {
+	return baseConfig(r.LLM)
+}
+
+// RetryEmbedder retries the failed requests of an Embedder.
+type RetryEmbedder struct {
+	Embedder Embedder
+	Config   RetryConfig
+}
+
+// NewRetryEmbedder wraps embedder to retry its failed requests.
+func NewRetryEmbedder(embedder Embedder, config RetryConfig) *RetryEmbedder {
+	return &RetryEmbedder{Embedder: embedder, Config: config}
+}
+
+// GetEmbedding retrieves embeddings, retrying transient failures.
+func (r *RetryEmbedder) GetEmbedding(ctx context.Context, texts []string, options ...EmbeddingOptions) ([]Embedding, error) {
+	var embeddings []Embedding
+	err := Retry(ctx, r.Config, func() (err error) {
+		embeddings, err = r.Embedder.GetEmbedding(ctx, texts, options...)
+		return err
+	})
+	return embeddings, err
+}
+
+func (r *RetryEmbedder) embeddingConfig() EmbeddingConfig {
+	return baseEmbeddingConfig(r.Embedder)
+}
@@ -0,0 +1,150 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// testRetryConfig retries quickly, without jitter.
+func testRetryConfig(maxRetries int) RetryConfig {
+	return RetryConfig{
+		MaxRetries:     maxRetries,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     4 * time.Millisecond,
+		Multiplier:     2,
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transient := &APIError{StatusCode: http.StatusServiceUnavailable}
+	permanent := &APIError{StatusCode: http.StatusBadRequest}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"transient then success", []error{transient, transient, nil}, 3, nil},
+		{"permanent", []error{permanent, nil}, 1, permanent},
+		{"retries exhausted", []error{transient, transient, transient, transient, nil}, 3, transient},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			err := Retry(context.Background(), testRetryConfig(2), func() error {
+				calls++
+				return test.errs[calls-1]
+			})
+			if calls != test.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, test.wantCalls)
+			}
+			if test.wantErr == nil && err != nil || !errors.Is(err, test.wantErr) {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	config := testRetryConfig(5)
+	config.InitialBackoff = time.Hour
+	calls := 0
+	err := Retry(ctx, config, func() error {
+		calls++
+		cancel()
+		return &APIError{StatusCode: http.StatusTooManyRequests}
+	})
+	if calls != 1 || err == nil {
+		t.Errorf("got %d calls and error %v, want 1 call and the error", calls, err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	config := testRetryConfig(1)
+	calls := 0
+	start := time.Now()
+	err := Retry(context.Background(), config, func() error {
+		calls++
+		if calls == 1 {
+			return &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 50 * time.Millisecond}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("retried after %v, want the 50ms requested by the server", elapsed)
+	}
+
+	retryInfo, err := status.New(codes.ResourceExhausted, "quota").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(3 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set("Retry-After", "7")
+	for _, test := range []struct {
+		err  error
+		want time.Duration
+	}{
+		{&APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second}, time.Second},
+		{&googleapi.Error{Code: http.StatusTooManyRequests, Header: header}, 7 * time.Second},
+		{retryInfo.Err(), 3 * time.Second},
+		{errors.New("other"), 0},
+	} {
+		if got := RetryAfter(test.err); got != test.want {
+			t.Errorf("RetryAfter(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{&APIError{StatusCode: http.StatusRequestTimeout}, true},
+		{&APIError{StatusCode: http.StatusBadGateway}, true},
+		{&APIError{StatusCode: http.StatusBadRequest}, false},
+		{&APIError{StatusCode: http.StatusUnauthorized}, false},
+		{fmt.Errorf("wrapped: %w", &APIError{StatusCode: http.StatusInternalServerError}), true},
+		{&googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{&googleapi.Error{Code: http.StatusNotFound}, false},
+		{status.Error(codes.Unavailable, "unavailable"), true},
+		{status.Error(codes.ResourceExhausted, "quota"), true},
+		{status.Error(codes.InvalidArgument, "invalid"), false},
+		{timeoutError{}, true},
+		{context.DeadlineExceeded, true},
+		{context.Canceled, false},
+		{io.ErrUnexpectedEOF, true},
+		{fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{errors.New("invalid response"), false},
+	}
+	for _, test := range tests {
+		if got := IsRetryable(test.err); got != test.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package llms
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// StreamChunk is a part of a streamed response. The last chunk of a
+// successful stream has Done set, with the finish reason and the usage of
+// the whole request.
+type StreamChunk struct {
+	Delta        string
+	Done         bool
+	FinishReason string
+	Usage        Usage
+}
+
+// Streamer is implemented by services which can stream text responses.
+//
+// The returned sequence sends the request when iterated and yields the
+// response as it is generated. An error ends the sequence. Canceling ctx or
+// stopping the iteration early aborts the request.
+type Streamer interface {
+	SendMessageStream(ctx context.Context, prompt string, options ...MessageOptions) iter.Seq2[StreamChunk, error]
+}
+
+// Stream streams the response to prompt if llm implements Streamer, and
+// yields the whole response as a single chunk otherwise.
+func Stream(ctx context.Context, llm MessageSender, prompt string, options ...MessageOptions) iter.Seq2[StreamChunk, error] {
+	if streamer, ok := llm.(Streamer); ok {
+		return streamer.SendMessageStream(ctx, prompt, options...)
+	}
+	return func(yield func(StreamChunk, error) bool) {
+		response, err := llm.SendMessage(ctx, prompt, options...)
+		if err != nil {
+			yield(StreamChunk{}, err)
+			return
+		}
+		text, ok := response.(string)
+		if !ok {
+			yield(StreamChunk{}, fmt.Errorf("%w: got %T, want string", ErrInvalidResponse, response))
+			return
+		}
+		if yield(StreamChunk{Delta: text}, nil) {
+			yield(StreamChunk{Done: true}, nil)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package llms
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// Usage counts the tokens of requests.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	EmbeddingTokens  int
+}
+
+// Add adds the tokens of other to u.
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.EmbeddingTokens += other.EmbeddingTokens
+}
+
+// Pricing is the price of a model in a currency unit per million tokens.
+type Pricing struct {
+	Prompt     float64
+	Completion float64
+	Embedding  float64
+}
+
+// Cost returns the price of usage.
+func (p Pricing) Cost(usage Usage) float64 {
+	return (float64(usage.PromptTokens)*p.Prompt +
+		float64(usage.CompletionTokens)*p.Completion +
+		float64(usage.EmbeddingTokens)*p.Embedding) / 1e6
+}
+
+type usageKey struct {
+	model     string
+	operation string
+	document  string
+}
+
+// UsageTracker aggregates the usage recorded by the providers for the
+// requests made with a context carrying it, see WithUsageTracker. It is
+// safe for concurrent use.
+type UsageTracker struct {
+	mu    sync.Mutex
+	usage map[usageKey]Usage
+}
+
+// NewUsageTracker creates an empty tracker.
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{usage: make(map[usageKey]Usage)}
+}
+
+type usageContextKey int
+
+const (
+	trackerKey usageContextKey = iota
+	operationKey
+	documentKey
+)
+
+// WithUsageTracker returns a context whose requests record their usage in tracker.
+func WithUsageTracker(ctx context.Context, tracker *UsageTracker) context.Context {
+	return context.WithValue(ctx, trackerKey, tracker)
+}
+
+// UsageTrackerFrom returns the tracker of ctx, or nil if there is none.
+func UsageTrackerFrom(ctx context.Context) *UsageTracker {
+	tracker, _ := ctx.Value(trackerKey).(*UsageTracker)
+	return tracker
+}
+
+// WithOperation returns a context whose usage is attributed to operation.
+func WithOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey, operation)
+}
+
+// WithDocument returns a context whose usage is attributed to document.
+func WithDocument(ctx context.Context, document string) context.Context {
+	return context.WithValue(ctx, documentKey, document)
+}
+
+// RecordUsage records the usage of a request to model in the tracker of
+// ctx, under the operation and document of ctx. It does nothing if ctx has
+// no tracker. Implementations of LLMService call it for every response.
+func RecordUsage(ctx context.Context, model string, usage Usage) {
+	tracker := UsageTrackerFrom(ctx)
+	if tracker == nil {
+		return
+	}
+	operation, _ := ctx.Value(operationKey).(string)
+	document, _ := ctx.Value(documentKey).(string)
+	key := usageKey{model: model, operation: operation, document: document}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	total := tracker.usage[key]
+	total.Add(usage)
+	tracker.usage[key] = total
+}
+
+// UsageCost is an amount of usage and its cost.
+type UsageCost struct {
+	Usage
+	Cost float64
+}
+
+func (u *UsageCost) add(usage Usage, cost float64) {
+	u.Usage.Add(usage)
+	u.Cost += cost
+}
+
+// UsageReport breaks the usage recorded by a tracker down by model,
+// operation and document. Usage without an operation or a document is
+// reported under the empty string.
+type UsageReport struct {
+	Total       UsageCost
+	ByModel     map[string]UsageCost
+	ByOperation map[string]UsageCost
+	ByDocument  map[string]UsageCost
+}
+
+// Report aggregates the recorded usage, priced with the pricing of each
+// model. Models without pricing cost nothing.
+func (t *UsageTracker) Report(pricing map[string]Pricing) UsageReport {
+	report := UsageReport{
+		ByModel:     make(map[string]UsageCost),
+		ByOperation: make(map[string]UsageCost),
+		ByDocument:  make(map[string]UsageCost),
+	}
+	add := func(breakdown map[string]UsageCost, key string, usage Usage, cost float64) {
+		total := breakdown[key]
+		total.add(usage, cost)
+		breakdown[key] = total
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, usage := range t.usage {
+		cost := pricing[key.model].Cost(usage)
+		report.Total.add(usage, cost)
+		add(report.ByModel, key.model, usage, cost)
+		add(report.ByOperation, key.operation, usage, cost)
+		add(report.ByDocument, key.document, usage, cost)
+	}
+	return report
+}
+
+// Reset discards the recorded usage.
+func (t *UsageTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.usage)
+}
+
+// String formats the report as tables by model, by operation and by document.
+func (r UsageReport) String() string {
+	var b strings.Builder
+	writeTable := func(title string, breakdown map[string]UsageCost) {
+		fmt.Fprintf(&b, "%-24s %12s %12s %12s %10s\n", title, "prompt", "completion", "embedding", "cost")
+		for _, key := range slices.Sorted(maps.Keys(breakdown)) {
+			u := breakdown[key]
+			fmt.Fprintf(&b, "%-24s %12d %12d %12d %10.4f\n", key, u.PromptTokens, u.CompletionTokens, u.EmbeddingTokens, u.Cost)
+		}
+	}
+	writeTable("model", r.ByModel)
+	b.WriteString("\n")
+	writeTable("operation", r.ByOperation)
+	b.WriteString("\n")
+	writeTable("document", r.ByDocument)
+	fmt.Fprintf(&b, "\n%-24s %12d %12d %12d %10.4f\n", "total",
+		r.Total.PromptTokens, r.Total.CompletionTokens, r.Total.EmbeddingTokens, r.Total.Cost)
+	return b.String()
+}
+
+// estimateTokens estimates the number of tokens of texts from their length,
+// for providers which do not report it.
+func estimateTokens(texts []string) int {
+	chars := 0
+	for _, text := range texts {
+		chars += len(text)
+	}
+	return chars / types.TOKEN_TO_CHAR_RATIO
+}
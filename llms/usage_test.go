@@ -0,0 +1,68 @@
+package llms
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestUsageReport(t *testing.T) {
+	tracker := NewUsageTracker()
+	ctx := WithUsageTracker(context.Background(), tracker)
+	first := WithDocument(WithOperation(ctx, "extraction"), "first")
+	RecordUsage(first, "chat", Usage{PromptTokens: 100, CompletionTokens: 10})
+	RecordUsage(first, "chat", Usage{PromptTokens: 50, CompletionTokens: 5})
+	RecordUsage(WithDocument(WithOperation(ctx, "embedding"), "first"), "embed", Usage{EmbeddingTokens: 20})
+	RecordUsage(WithDocument(WithOperation(ctx, "extraction"), "second"), "chat", Usage{PromptTokens: 200, CompletionTokens: 20})
+	RecordUsage(WithOperation(ctx, "query"), "local", Usage{PromptTokens: 1000, CompletionTokens: 100})
+	// Usage without a tracker is not recorded.
+	RecordUsage(context.Background(), "chat", Usage{PromptTokens: 1})
+
+	// The model without pricing costs nothing.
+	report := tracker.Report(map[string]Pricing{
+		"chat":  {Prompt: 2, Completion: 10},
+		"embed": {Embedding: 0.5},
+	})
+	costs := []struct {
+		breakdown map[string]UsageCost
+		key       string
+		usage     Usage
+		cost      float64
+	}{
+		{report.ByModel, "chat", Usage{PromptTokens: 350, CompletionTokens: 35}, 0.00105},
+		{report.ByModel, "embed", Usage{EmbeddingTokens: 20}, 0.00001},
+		{report.ByModel, "local", Usage{PromptTokens: 1000, CompletionTokens: 100}, 0},
+		{report.ByOperation, "extraction", Usage{PromptTokens: 350, CompletionTokens: 35}, 0.00105},
+		{report.ByOperation, "embedding", Usage{EmbeddingTokens: 20}, 0.00001},
+		{report.ByOperation, "query", Usage{PromptTokens: 1000, CompletionTokens: 100}, 0},
+		{report.ByDocument, "first", Usage{PromptTokens: 150, CompletionTokens: 15, EmbeddingTokens: 20}, 0.00046},
+		{report.ByDocument, "second", Usage{PromptTokens: 200, CompletionTokens: 20}, 0.0006},
+		{report.ByDocument, "", Usage{PromptTokens: 1000, CompletionTokens: 100}, 0},
+	}
+	for _, c := range costs {
+		got := c.breakdown[c.key]
+		if got.Usage != c.usage || math.Abs(got.Cost-c.cost) > 1e-12 {
+			t.Errorf("%q: got %+v, want %+v costing %v", c.key, got, c.usage, c.cost)
+		}
+	}
+	if len(report.ByModel) != 3 || len(report.ByOperation) != 3 || len(report.ByDocument) != 3 {
+		t.Errorf("got report %+v, want 3 entries per breakdown", report)
+	}
+	want := Usage{PromptTokens: 1350, CompletionTokens: 135, EmbeddingTokens: 20}
+	if report.Total.Usage != want || math.Abs(report.Total.Cost-0.00106) > 1e-12 {
+		t.Errorf("got total %+v, want %+v costing 0.00106", report.Total, want)
+	}
+
+	text := report.String()
+	for _, row := range []string{"chat", "query", "second", "total"} {
+		if !strings.Contains(text, "\n"+row+" ") {
+			t.Errorf("the report misses the row %q:\n%s", row, text)
+		}
+	}
+
+	tracker.Reset()
+	if report := tracker.Report(nil); report.Total != (UsageCost{}) || len(report.ByModel) != 0 {
+		t.Errorf("got report %+v after Reset", report)
+	}
+}
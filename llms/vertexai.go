@@ -2,29 +2,26 @@ package llms
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"iter"
 	"reflect"
 
 	aiplatform "cloud.google.com/go/aiplatform/apiv1"
 	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
 	"cloud.google.com/go/vertexai/genai"
 	"github.com/binarycraft007/fast-graphrag-go/llms/vertexai"
-	"github.com/binarycraft007/fast-graphrag-go/types"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
-// OpenAILLMService implements the LLMService interface for OpenAI.
+// VertexAILLMService implements the ChatModel interface for Vertex AI.
 type VertexAILLMService struct {
-	Config          *MessageConfig
-	APIKey          string
-	MaxRetries      int
-	Client          *genai.Client
-	EmbeddingClient *aiplatform.PredictionClient
-	MaxTokens       int
-	EmbeddingDim    int
+	Config     *MessageConfig
+	APIKey     string
+	MaxRetries int
+	Client     *genai.Client
 }
 
 func DefaultVertexAILLMOptions() *MessageConfig {
@@ -32,7 +29,6 @@ func DefaultVertexAILLMOptions() *MessageConfig {
 		Model:        "gemini-1.5-flash-002",
 		MaxTokens:    8000,
 		ResponseType: reflect.TypeOf(""),
-		EmbeddingDim: 768,
 	}
 }
 
@@ -46,119 +42,256 @@ func NewVertexAILLMService(ctx context.Context, options ...MessageOptions) (*Ver
 	if err != nil {
 		return nil, err
 	}
-
-	apiEndpoint := fmt.Sprintf("%s-aiplatform.googleapis.com:443", config.Location)
-	embeddingClient, err := aiplatform.NewPredictionClient(ctx, option.WithEndpoint(apiEndpoint))
-	if err != nil {
-		return nil, err
-	}
 	return &VertexAILLMService{
-		Config:          config,
-		Client:          client,
-		EmbeddingClient: embeddingClient,
-		MaxRetries:      3,
+		Config:     config,
+		Client:     client,
+		MaxRetries: 3,
 	}, nil
 }
 
 // SendMessage sends a message to the language model and receives a response.
+// Transient failures are retried up to MaxRetries times.
 func (g *VertexAILLMService) SendMessage(ctx context.Context, prompt string, options ...MessageOptions) (any, error) {
+	config := *g.Config
 	for _, opt := range options {
-		opt(g.Config)
+		opt(&config)
+	}
+
+	var response any
+	err := Retry(ctx, retryConfig(g.MaxRetries), func() (err error) {
+		response, err = g.sendMessage(ctx, prompt, config)
+		return err
+	})
+	return response, err
+}
+
+func (g *VertexAILLMService) sendMessage(ctx context.Context, prompt string, config MessageConfig) (any, error) {
+	cs, err := g.newChat(config)
+	if err != nil {
+		return nil, err
 	}
+	resp, err := cs.SendMessage(ctx, genai.Text(prompt))
+	if err != nil {
+		return nil, err
+	}
+	if resp.UsageMetadata != nil {
+		RecordUsage(ctx, config.Model, Usage{
+			PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+			CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+		})
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, errors.New("no candidates in response")
+	}
+
+	var output string
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if text, ok := part.(genai.Text); ok {
+			output += string(text)
+		}
+	}
+	if config.ResponseType.Kind() == reflect.String {
+		return output, nil
+	}
+	return unmarshalResponse(config.ResponseType, output)
+}
 
-	genaiModel := g.Client.GenerativeModel(g.Config.Model)
+// newChat starts a chat session configured by config.
+func (g *VertexAILLMService) newChat(config MessageConfig) (*genai.ChatSession, error) {
+	genaiModel := g.Client.GenerativeModel(config.Model)
 	genaiModel.SetCandidateCount(1)
 	genaiModel.SetTemperature(0)
-	genaiModel.SetMaxOutputTokens(int32(g.Config.MaxTokens))
-
-	cs := genaiModel.StartChat()
-	if g.Config.SystemPrompt != "" {
+	genaiModel.SetMaxOutputTokens(int32(config.MaxTokens))
+	if config.SystemPrompt != "" {
 		genaiModel.SystemInstruction = &genai.Content{
 			Role:  "system",
-			Parts: []genai.Part{genai.Text(g.Config.SystemPrompt)},
+			Parts: []genai.Part{genai.Text(config.SystemPrompt)},
 		}
 	}
-	for _, content := range g.Config.HistoryMessages {
-		cs.History = append(cs.History, content.(*genai.Content))
-	}
-	switch g.Config.ResponseType.Kind() {
+	switch config.ResponseType.Kind() {
 	case reflect.String:
-		resp, err := cs.SendMessage(ctx, genai.Text(prompt))
-		if err != nil {
-			return nil, err
-		}
-
-		g.Config.HistoryMessages = append(g.Config.HistoryMessages, resp.Candidates[0])
-
-		var output string
-		for _, part := range resp.Candidates[0].Content.Parts {
-			if text, ok := part.(genai.Text); ok {
-				output += string(text)
-			}
-		}
-		return output, nil
 	case reflect.Slice, reflect.Array, reflect.Struct:
-		schema, err := vertexai.GenerateSchemaFromType(g.Config.ResponseType)
+		schema, err := vertexai.GenerateSchemaFromType(config.ResponseType)
 		if err != nil {
 			return nil, err
 		}
 		genaiModel.GenerationConfig.ResponseMIMEType = "application/json"
 		genaiModel.GenerationConfig.ResponseSchema = schema
-		resp, err := cs.SendMessage(ctx, genai.Text(prompt))
-		if err != nil {
-			return nil, err
+	default:
+		return nil, errors.New("unsupported type")
+	}
+
+	cs := genaiModel.StartChat()
+	history, err := vertexHistory(config.HistoryMessages)
+	if err != nil {
+		return nil, err
+	}
+	cs.History = history
+	return cs, nil
+}
+
+// SendMessageStream streams the text response to prompt. Transient
+// failures are retried up to MaxRetries times until the first chunk arrives.
+func (g *VertexAILLMService) SendMessageStream(ctx context.Context, prompt string, options ...MessageOptions) iter.Seq2[StreamChunk, error] {
+	config := *g.Config
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	return func(yield func(StreamChunk, error) bool) {
+		if config.ResponseType.Kind() != reflect.String {
+			yield(StreamChunk{}, errors.New("only text responses can be streamed"))
+			return
 		}
+		// Stopping the iteration early cancels the request.
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
 
-		g.Config.HistoryMessages = append(g.Config.HistoryMessages, resp.Candidates[0])
+		var it *genai.GenerateContentResponseIterator
+		var resp *genai.GenerateContentResponse
+		err := Retry(ctx, retryConfig(g.MaxRetries), func() error {
+			// A chat session records the prompt in its history on every
+			// send, so each attempt starts a new one.
+			cs, err := g.newChat(config)
+			if err != nil {
+				return err
+			}
+			it = cs.SendMessageStream(ctx, genai.Text(prompt))
+			resp, err = it.Next()
+			return err
+		})
 
-		var jsonData string
-		for _, part := range resp.Candidates[0].Content.Parts {
-			if text, ok := part.(genai.Text); ok {
-				jsonData += string(text)
+		var last StreamChunk
+		for ; err == nil; resp, err = it.Next() {
+			if resp.UsageMetadata != nil {
+				last.Usage = Usage{
+					PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+					CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+				}
+			}
+			if len(resp.Candidates) == 0 {
+				continue
+			}
+			candidate := resp.Candidates[0]
+			if candidate.FinishReason != genai.FinishReasonUnspecified {
+				last.FinishReason = candidate.FinishReason.String()
+			}
+			if candidate.Content == nil {
+				continue
+			}
+			var delta string
+			for _, part := range candidate.Content.Parts {
+				if text, ok := part.(genai.Text); ok {
+					delta += string(text)
+				}
+			}
+			if delta != "" && !yield(StreamChunk{Delta: delta}, nil) {
+				return
 			}
 		}
+		if !errors.Is(err, iterator.Done) {
+			yield(StreamChunk{}, err)
+			return
+		}
+		RecordUsage(ctx, config.Model, last.Usage)
+		last.Done = true
+		yield(last, nil)
+	}
+}
 
-		// Create a new instance of the type using reflect.New
-		instance := reflect.New(g.Config.ResponseType).Interface()
-
-		// Unmarshal JSON into the dynamically created instance
-		err = json.Unmarshal([]byte(jsonData), instance)
-		if err != nil {
-			return nil, fmt.Errorf("Error unmarshaling: %v", err)
+// vertexHistory converts history messages, either ChatMessage or
+// *genai.Content, to the contents of a chat session.
+func vertexHistory(messages []Message) ([]*genai.Content, error) {
+	history := make([]*genai.Content, len(messages))
+	for i, message := range messages {
+		switch message := message.(type) {
+		case *genai.Content:
+			history[i] = message
+		case ChatMessage:
+			role := "user"
+			if message.Role == RoleAssistant {
+				role = "model"
+			}
+			history[i] = &genai.Content{Role: role, Parts: []genai.Part{genai.Text(message.Content)}}
+		default:
+			return nil, fmt.Errorf("unsupported history message type %T", message)
 		}
-		return instance, nil
-	default:
-		return nil, errors.New("unsupported type")
 	}
+	return history, nil
 }
 
-// GetEmbedding retrieves embeddings for the given texts.
-func (g *VertexAILLMService) GetEmbedding(ctx context.Context, texts []string, options ...MessageOptions) ([]Embedding, error) {
-	for _, opt := range options {
-		opt(g.Config)
+// StartChat starts a conversation.
+func (g *VertexAILLMService) StartChat(options ...MessageOptions) *ChatSession {
+	return NewChatSession(g, options...)
+}
+
+func (g *VertexAILLMService) messageConfig() MessageConfig {
+	return *g.Config
+}
+
+// VertexAIEmbedder implements the Embedder interface for the text
+// embedding models of Vertex AI.
+type VertexAIEmbedder struct {
+	Config     *EmbeddingConfig
+	MaxRetries int
+	Client     *aiplatform.PredictionClient
+}
+
+func DefaultVertexAIEmbeddingOptions() *EmbeddingConfig {
+	return &EmbeddingConfig{
+		Model:                "text-embedding-005",
+		Dimension:            768,
+		BatchSize:            250,
+		MaxBatchTokens:       20000,
+		MaxConcurrentBatches: 4,
 	}
+}
 
-	chunks := chunkTexts(texts, g.MaxTokens*types.TOKEN_TO_CHAR_RATIO)
+// NewVertexAIEmbedder initializes a Vertex AI based embedder for the
+// models of projectID in location.
+func NewVertexAIEmbedder(ctx context.Context, projectID, location string, options ...EmbeddingOptions) (*VertexAIEmbedder, error) {
+	config := DefaultVertexAIEmbeddingOptions()
+	config.ProjectID = projectID
+	config.Location = location
+	for _, opt := range options {
+		opt(config)
+	}
+	apiEndpoint := fmt.Sprintf("%s-aiplatform.googleapis.com:443", config.Location)
+	client, err := aiplatform.NewPredictionClient(ctx, option.WithEndpoint(apiEndpoint))
+	if err != nil {
+		return nil, err
+	}
+	return &VertexAIEmbedder{
+		Config:     config,
+		MaxRetries: 3,
+		Client:     client,
+	}, nil
+}
 
-	var embeddings []Embedding
-	for _, chunk := range chunks {
-		embedds, err := g.embedTexts(ctx, chunk)
-		if err != nil {
-			return nil, err
-		}
-		embeddings = append(embeddings, embedds...)
+// GetEmbedding retrieves embeddings for the given texts.
+func (g *VertexAIEmbedder) GetEmbedding(ctx context.Context, texts []string, options ...EmbeddingOptions) ([]Embedding, error) {
+	config := *g.Config
+	for _, opt := range options {
+		opt(&config)
 	}
 
-	return embeddings, nil
+	return embedInBatches(ctx, config, texts, func(ctx context.Context, batch []string) ([]Embedding, error) {
+		var embeddings []Embedding
+		err := Retry(ctx, retryConfig(g.MaxRetries), func() (err error) {
+			embeddings, err = g.embedTexts(ctx, config, batch)
+			return err
+		})
+		return embeddings, err
+	})
 }
 
-// embedTexts shows how embeddings are set for text-embedding-005 model
-func (g *VertexAILLMService) embedTexts(ctx context.Context, texts []string) ([]Embedding, error) {
+// embedTexts embeds a batch of texts.
+func (g *VertexAIEmbedder) embedTexts(ctx context.Context, config EmbeddingConfig, texts []string) ([]Embedding, error) {
 	endpoint := fmt.Sprintf(
 		"projects/%s/locations/%s/publishers/google/models/%s",
-		g.Config.ProjectID,
-		g.Config.Location,
-		g.Config.Model,
+		config.ProjectID,
+		config.Location,
+		config.Model,
 	)
 	instances := make([]*structpb.Value, len(texts))
 	for i, text := range texts {
@@ -170,29 +303,38 @@ func (g *VertexAILLMService) embedTexts(ctx context.Context, texts []string) ([]
 		})
 	}
 
-	params := structpb.NewStructValue(&structpb.Struct{
-		Fields: map[string]*structpb.Value{
-			"outputDimensionality": structpb.NewNumberValue(float64(g.Config.EmbeddingDim)),
-		},
-	})
+	// Without a dimension the model returns its default one.
+	fields := make(map[string]*structpb.Value)
+	if config.Dimension > 0 {
+		fields["outputDimensionality"] = structpb.NewNumberValue(float64(config.Dimension))
+	}
+	params := structpb.NewStructValue(&structpb.Struct{Fields: fields})
 
 	req := &aiplatformpb.PredictRequest{
 		Endpoint:   endpoint,
 		Instances:  instances,
 		Parameters: params,
 	}
-	resp, err := g.EmbeddingClient.Predict(ctx, req)
+	resp, err := g.Client.Predict(ctx, req)
 	if err != nil {
 		return nil, err
 	}
 
 	embeddings := make([]Embedding, len(resp.Predictions))
+	var tokens int
 	for i, prediction := range resp.Predictions {
-		values := prediction.GetStructValue().Fields["embeddings"].GetStructValue().Fields["values"].GetListValue().Values
+		result := prediction.GetStructValue().Fields["embeddings"].GetStructValue()
+		tokens += int(result.GetFields()["statistics"].GetStructValue().GetFields()["token_count"].GetNumberValue())
+		values := result.GetFields()["values"].GetListValue().GetValues()
 		embeddings[i].Vector = make([]float32, len(values))
 		for j, value := range values {
 			embeddings[i].Vector[j] = float32(value.GetNumberValue())
 		}
 	}
+	RecordUsage(ctx, config.Model, Usage{EmbeddingTokens: tokens})
 	return embeddings, nil
 }
+
+func (g *VertexAIEmbedder) embeddingConfig() EmbeddingConfig {
+	return *g.Config
+}
@@ -10,8 +10,24 @@ var entity_relationship_extraction string
 //go:embed entity_relationship_extraction.json
 var EntityRelationshipExtractionExample string
 
+//go:embed summarize_entity_descriptions.md
+var summarize_entity_descriptions string
+
+//go:embed edges_group_similar.md
+var edges_group_similar string
+
+//go:embed entity_extraction_query.md
+var entity_extraction_query string
+
+//go:embed generate_response_query.md
+var generate_response_query string
+
 var Prompts = map[string]string{
 	"entity_relationship_extraction":               entity_relationship_extraction,
 	"entity_relationship_continue_extraction":      "MANY entities were missed in the last extraction.  Add them below using the same format:",
 	"entity_relationship_gleaning_done_extraction": "Retrospectively check if all entities have been correctly identified: answer done if so, or continue if there are still entities that need to be added.",
+	"summarize_entity_descriptions":                summarize_entity_descriptions,
+	"edges_group_similar":                          edges_group_similar,
+	"entity_extraction_query":                      entity_extraction_query,
+	"generate_response_query":                      generate_response_query,
 }
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+	"github.com/binarycraft007/fast-graphrag-go/storage"
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// BaseNodeUpsertPolicy defines the interface for node upserting logic.
+type BaseNodeUpsertPolicy[Node, Edge, ID any] interface {
+	UpsertNodes(ctx context.Context, llm llms.ChatModel, graph storage.BaseGraphStorage[Node, Edge, ID], nodes []Node) error
+}
+
+// BaseEdgeUpsertPolicy defines the interface for edge upserting logic.
+type BaseEdgeUpsertPolicy[Node, Edge, ID any] interface {
+	UpsertEdges(ctx context.Context, llm llms.ChatModel, graph storage.BaseGraphStorage[Node, Edge, ID], edges []Edge) error
+}
+
+// DefaultGraphUpsertPolicy upserts the nodes and then the edges of a graph
+// with separate policies.
+type DefaultGraphUpsertPolicy[Node, Edge, ID any] struct {
+	NodePolicy BaseNodeUpsertPolicy[Node, Edge, ID]
+	EdgePolicy BaseEdgeUpsertPolicy[Node, Edge, ID]
+}
+
+// NewDefaultGraphUpsertPolicy creates a policy which summarizes long entity
+// descriptions and inserts the relations as they are.
+func NewDefaultGraphUpsertPolicy() *DefaultGraphUpsertPolicy[types.Entity, types.Relation, string] {
+	return &DefaultGraphUpsertPolicy[types.Entity, types.Relation, string]{
+		NodePolicy: NewSummarizeNodeUpsertPolicy(),
+		EdgePolicy: &DefaultEdgeUpsertPolicy{},
+	}
+}
+
+// Upsert upserts the nodes before the edges so that edges can reference them.
+func (p *DefaultGraphUpsertPolicy[Node, Edge, ID]) Upsert(
+	ctx context.Context, llm llms.ChatModel, graph storage.BaseGraphStorage[Node, Edge, ID], nodes []Node, edges []Edge,
+) error {
+	if err := p.NodePolicy.UpsertNodes(ctx, llm, graph, nodes); err != nil {
+		return err
+	}
+	return p.EdgePolicy.UpsertEdges(ctx, llm, graph, edges)
+}
+
+// SummarizeNodeUpsertPolicyConfig configures SummarizeNodeUpsertPolicy.
+type SummarizeNodeUpsertPolicyConfig struct {
+	// MaxNodeDescriptionSize is the size in tokens above which the
+	// description of an entity is summarized by the LLM.
+	MaxNodeDescriptionSize int
+}
+
+// NewSummarizeNodeUpsertPolicyConfig returns the default configuration.
+func NewSummarizeNodeUpsertPolicyConfig() SummarizeNodeUpsertPolicyConfig {
+	return SummarizeNodeUpsertPolicyConfig{
+		MaxNodeDescriptionSize: 512,
+	}
+}
+
+// SummarizeNodeUpsertPolicy merges entities with the stored entity of the
+// same name by concatenating their descriptions. Once the description grows
+// beyond the configured size, the LLM summarizes it into a single one.
+type SummarizeNodeUpsertPolicy struct {
+	Config SummarizeNodeUpsertPolicyConfig
+}
+
+// NewSummarizeNodeUpsertPolicy creates a policy with the default configuration.
+func NewSummarizeNodeUpsertPolicy() *SummarizeNodeUpsertPolicy {
+	return &SummarizeNodeUpsertPolicy{Config: NewSummarizeNodeUpsertPolicyConfig()}
+}
+
+// UpsertNodes merges nodes into graph.
+func (p *SummarizeNodeUpsertPolicy) UpsertNodes(
+	ctx context.Context, llm llms.ChatModel, graph storage.BaseGraphStorage[types.Entity, types.Relation, string], nodes []types.Entity,
+) error {
+	var merged []*mergedEntity
+	index := make(map[string]*mergedEntity)
+	for _, node := range nodes {
+		entity, ok := index[node.Name]
+		if !ok {
+			entity = newMergedEntity(node.Name)
+			if existing, found := graph.GetNode(node.Name); found {
+				entity.add(existing)
+			}
+			index[node.Name] = entity
+			merged = append(merged, entity)
+		}
+		entity.add(node)
+	}
+
+	var wg sync.WaitGroup
+	ctx = llms.WithOperation(ctx, OperationSummarization)
+	entities := make([]types.Entity, len(merged))
+	errs := make([]error, len(merged))
+	maxSize := p.Config.MaxNodeDescriptionSize * types.TOKEN_TO_CHAR_RATIO
+	for i, m := range merged {
+		entities[i] = m.entity()
+		if len(entities[i].Description) <= maxSize {
+			continue
+		}
+		wg.Add(1)
+		go func(entity *types.Entity, err *error) {
+			defer wg.Done()
+			entity.Description, *err = summarizeDescription(ctx, llm, entity.Name, entity.Description)
+		}(&entities[i], &errs[i])
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for _, entity := range entities {
+		if err := graph.UpsertNode(entity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func summarizeDescription(ctx context.Context, llm llms.ChatModel, name, description string) (string, error) {
+	summary, err := llms.FormatAndGenerate[string](
+		ctx,
+		"summarize_entity_descriptions",
+		llm,
+		map[string]any{"name": name, "description": description},
+	)
+	if err != nil {
+		return "", fmt.Errorf("summarizing description of %q: %w", name, err)
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+// DefaultEdgeUpsertPolicy inserts relations as they are. Relations repeating
+// a stored relation between the same entities with the same description are
+// merged into it, and relations whose entities are not in the graph are dropped.
+type DefaultEdgeUpsertPolicy struct{}
+
+// UpsertEdges merges edges into graph.
+func (p *DefaultEdgeUpsertPolicy) UpsertEdges(
+	ctx context.Context, llm llms.ChatModel, graph storage.BaseGraphStorage[types.Entity, types.Relation, string], edges []types.Relation,
+) error {
+	for _, edge := range edges {
+		if !hasEndpoints(graph, edge) {
+			log.Printf("dropping relation %q -> %q: unknown entity", edge.Source, edge.Target)
+			continue
+		}
+		for _, existing := range graph.GetEdges(edge.Source, edge.Target) {
+			if existing.Description == edge.Description {
+				edge.Chunks = unionChunks(existing.Chunks, edge.Chunks)
+				break
+			}
+		}
+		if err := graph.UpsertEdge(edge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasEndpoints(graph storage.BaseGraphStorage[types.Entity, types.Relation, string], edge types.Relation) bool {
+	_, hasSource := graph.GetNode(edge.Source)
+	_, hasTarget := graph.GetNode(edge.Target)
+	return hasSource && hasTarget
+}
+
+// unionChunks returns the sorted union of chunk IDs.
+func unionChunks(chunks ...[]uint64) []uint64 {
+	union := slices.Concat(chunks...)
+	slices.Sort(union)
+	return slices.Compact(union)
+}
+
+// MergeSimilarEdgeUpsertPolicyConfig configures MergeSimilarEdgeUpsertPolicy.
+type MergeSimilarEdgeUpsertPolicyConfig struct {
+	// SimilarityThreshold is the cosine similarity of the description
+	// embeddings above which two relations are considered for merging.
+	SimilarityThreshold float32
+}
+
+// NewMergeSimilarEdgeUpsertPolicyConfig returns the default configuration.
+func NewMergeSimilarEdgeUpsertPolicyConfig() MergeSimilarEdgeUpsertPolicyConfig {
+	return MergeSimilarEdgeUpsertPolicyConfig{
+		SimilarityThreshold: 0.85,
+	}
+}
+
+// EdgeMergeGroup is a group of relations the LLM found to be duplicates.
+type EdgeMergeGroup struct {
+	IDs         []int  `json:"ids"`
+	Description string `json:"description"`
+}
+
+// EdgeMergeResult is the LLM answer to the edges_group_similar prompt.
+type EdgeMergeResult struct {
+	Groups []EdgeMergeGroup `json:"grouped_facts"`
+}
+
+// MergeSimilarEdgeUpsertPolicy merges relations between the same entities
+// whose descriptions paraphrase each other. Candidates are found by the
+// similarity of their description embeddings, computed by Embedder, and
+// the LLM decides which of them to merge and how to describe the merged
+// relation. Only candidates including a new description are sent to the
+// LLM, and the embeddings of the descriptions are kept so that stored
+// relations are not embedded again. Merged relations keep the union of the
+// chunks of their parts, and relations whose entities are not in the graph
+// are dropped.
+type MergeSimilarEdgeUpsertPolicy struct {
+	Config   MergeSimilarEdgeUpsertPolicyConfig
+	Embedder llms.Embedder
+
+	mu         sync.Mutex
+	embeddings map[string][]float32
+}
+
+// NewMergeSimilarEdgeUpsertPolicy creates a policy with the default
+// configuration which embeds the descriptions with embedder.
+func NewMergeSimilarEdgeUpsertPolicy(embedder llms.Embedder) *MergeSimilarEdgeUpsertPolicy {
+	return &MergeSimilarEdgeUpsertPolicy{Config: NewMergeSimilarEdgeUpsertPolicyConfig(), Embedder: embedder}
+}
+
+// edgeGroup holds the relations between a pair of entities.
+type edgeGroup struct {
+	edges []types.Relation
+	// fresh marks the relations whose description is not stored yet.
+	fresh []bool
+}
+
+// add merges edge into the relation with the same description, or appends
+// it as a fresh relation.
+func (g *edgeGroup) add(edge types.Relation) {
+	for i := range g.edges {
+		if g.edges[i].Description == edge.Description {
+			g.edges[i].Chunks = unionChunks(g.edges[i].Chunks, edge.Chunks)
+			return
+		}
+	}
+	edge.Chunks = unionChunks(edge.Chunks)
+	g.edges = append(g.edges, edge)
+	g.fresh = append(g.fresh, true)
+}
+
+// UpsertEdges merges edges into graph.
+func (p *MergeSimilarEdgeUpsertPolicy) UpsertEdges(
+	ctx context.Context, llm llms.ChatModel, graph storage.BaseGraphStorage[types.Entity, types.Relation, string], edges []types.Relation,
+) error {
+	ctx = llms.WithOperation(ctx, OperationRelationMerging)
+
+	type endpoints struct{ a, b string }
+	var groups []*edgeGroup
+	groupIndex := make(map[endpoints]int)
+	for _, edge := range edges {
+		if !hasEndpoints(graph, edge) {
+			log.Printf("dropping relation %q -> %q: unknown entity", edge.Source, edge.Target)
+			continue
+		}
+		key := endpoints{edge.Source, edge.Target}
+		if key.b < key.a {
+			key.a, key.b = key.b, key.a
+		}
+		i, ok := groupIndex[key]
+		if !ok {
+			i = len(groups)
+			groupIndex[key] = i
+			stored := graph.GetEdges(edge.Source, edge.Target)
+			groups = append(groups, &edgeGroup{edges: stored, fresh: make([]bool, len(stored))})
+		}
+		groups[i].add(edge)
+	}
+
+	// Only groups with a fresh relation among others may have new duplicates.
+	var candidates []*edgeGroup
+	var descriptions []string
+	for _, group := range groups {
+		if len(group.edges) > 1 && slices.Contains(group.fresh, true) {
+			candidates = append(candidates, group)
+			for _, edge := range group.edges {
+				descriptions = append(descriptions, edge.Description)
+			}
+		}
+	}
+	embeddings, err := p.embed(ctx, descriptions)
+	if err != nil {
+		return err
+	}
+
+	type mergeJob struct {
+		group      *edgeGroup
+		removed    []bool
+		candidates []int
+	}
+	var jobs []mergeJob
+	removed := make(map[*edgeGroup][]bool)
+	for _, group := range groups {
+		removed[group] = make([]bool, len(group.edges))
+	}
+	for _, group := range candidates {
+		vectors := make([][]float32, len(group.edges))
+		for i, edge := range group.edges {
+			vectors[i] = embeddings[edge.Description]
+		}
+		for _, cluster := range p.similarClusters(vectors) {
+			if slices.ContainsFunc(cluster, func(i int) bool { return group.fresh[i] }) {
+				jobs = append(jobs, mergeJob{group: group, removed: removed[group], candidates: cluster})
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(jobs))
+	wg.Add(len(jobs))
+	for i, job := range jobs {
+		go func() {
+			defer wg.Done()
+			errs[i] = mergeSimilarEdges(ctx, llm, job.group.edges, job.removed, job.candidates)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		// A merged description may repeat the description of another
+		// relation: the later one is merged into the earlier one, which
+		// keeps its place.
+		var survivors []types.Relation
+		for j, edge := range group.edges {
+			if removed[group][j] {
+				continue
+			}
+			k := slices.IndexFunc(survivors, func(survivor types.Relation) bool {
+				return survivor.Description == edge.Description
+			})
+			if k >= 0 {
+				survivors[k].Chunks = unionChunks(survivors[k].Chunks, edge.Chunks)
+				continue
+			}
+			survivors = append(survivors, edge)
+		}
+		if err := graph.DeleteEdges(group.edges[0].Source, group.edges[0].Target); err != nil {
+			return err
+		}
+		for _, edge := range survivors {
+			if err := graph.UpsertEdge(edge); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// embed returns the embeddings of descriptions by description, embedding
+// the ones not embedded before.
+func (p *MergeSimilarEdgeUpsertPolicy) embed(ctx context.Context, descriptions []string) (map[string][]float32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.embeddings == nil {
+		p.embeddings = make(map[string][]float32)
+	}
+	embeddings := make(map[string][]float32, len(descriptions))
+	var missing []string
+	for _, description := range descriptions {
+		if vector, ok := p.embeddings[description]; ok {
+			embeddings[description] = vector
+		} else if _, ok := embeddings[description]; !ok {
+			embeddings[description] = nil
+			missing = append(missing, description)
+		}
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	retrieved, err := p.Embedder.GetEmbedding(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(retrieved) != len(missing) {
+		return nil, fmt.Errorf("got %d embeddings for %d descriptions", len(retrieved), len(missing))
+	}
+	for i, description := range missing {
+		embeddings[description] = retrieved[i].Vector
+		p.embeddings[description] = retrieved[i].Vector
+	}
+	return embeddings, nil
+}
+
+// similarClusters returns the indices of the clusters of at least two
+// relations connected by a similarity above the threshold.
+func (p *MergeSimilarEdgeUpsertPolicy) similarClusters(embeddings [][]float32) [][]int {
+	parent := make([]int, len(embeddings))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range embeddings {
+		for j := i + 1; j < len(embeddings); j++ {
+			if cosineSimilarity(embeddings[i], embeddings[j]) >= p.Config.SimilarityThreshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	var roots []int
+	for i := range embeddings {
+		root := find(i)
+		if members[root] == nil {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], i)
+	}
+	var clusters [][]int
+	for _, root := range roots {
+		if len(members[root]) > 1 {
+			clusters = append(clusters, members[root])
+		}
+	}
+	return clusters
+}
+
+// mergeSimilarEdges lets the LLM group the candidate relations of group.
+// Each merged group is written to its first relation and the other relations
+// of the group are marked as removed. Clusters never overlap, so concurrent
+// calls on the same group touch distinct relations.
+func mergeSimilarEdges(
+	ctx context.Context, llm llms.ChatModel, group []types.Relation, removed []bool, candidates []int,
+) error {
+	var facts strings.Builder
+	for i, candidate := range candidates {
+		fmt.Fprintf(&facts, "%d, %s\n", i, group[candidate].Description)
+	}
+	result, err := llms.FormatAndGenerate[EdgeMergeResult](
+		ctx,
+		"edges_group_similar",
+		llm,
+		map[string]any{"facts": strings.TrimSuffix(facts.String(), "\n")},
+	)
+	if err != nil {
+		return fmt.Errorf("merging relations %q -> %q: %w", group[0].Source, group[0].Target, err)
+	}
+
+	merged := make(map[int]bool)
+	for _, g := range result.Groups {
+		var ids []int
+		for _, id := range g.IDs {
+			if id >= 0 && id < len(candidates) && !merged[id] {
+				merged[id] = true
+				ids = append(ids, id)
+			}
+		}
+		description := strings.TrimSpace(g.Description)
+		if len(ids) < 2 || description == "" {
+			continue
+		}
+		first := &group[candidates[ids[0]]]
+		for _, id := range ids[1:] {
+			other := &group[candidates[id]]
+			first.Chunks = unionChunks(first.Chunks, other.Chunks)
+			removed[candidates[id]] = true
+		}
+		first.Description = description
+	}
+	return nil
+}
+
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(normA*normB))
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+	"github.com/binarycraft007/fast-graphrag-go/llms/llmtest"
+	"github.com/binarycraft007/fast-graphrag-go/storage"
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// vectorEmbedder embeds texts with fixed vectors and records the texts.
+type vectorEmbedder struct {
+	vectors  map[string][]float32
+	embedded []string
+}
+
+func (e *vectorEmbedder) GetEmbedding(ctx context.Context, texts []string, options ...llms.EmbeddingOptions) ([]llms.Embedding, error) {
+	e.embedded = append(e.embedded, texts...)
+	embeddings := make([]llms.Embedding, len(texts))
+	for i, text := range texts {
+		embeddings[i].Vector = e.vectors[text]
+	}
+	return embeddings, nil
+}
+
+func newEdgeTestGraph(t *testing.T, edges ...types.Relation) *storage.MemoryGraphStorage {
+	t.Helper()
+	graph := storage.NewMemoryGraphStorage()
+	for _, name := range []string{"ALICE", "BOB", "CAROL"} {
+		if err := graph.UpsertNode(types.Entity{Name: name, Type: "PERSON"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, edge := range edges {
+		if err := graph.UpsertEdge(edge); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return graph
+}
+
+// edgeChunks returns the chunks of the relations between source and target
+// by description.
+func edgeChunks(graph *storage.MemoryGraphStorage, source, target string) map[string][]uint64 {
+	chunks := make(map[string][]uint64)
+	for _, edge := range graph.GetEdges(source, target) {
+		chunks[edge.Description] = edge.Chunks
+	}
+	return chunks
+}
+
+func TestSummarizeNodeUpsertPolicy(t *testing.T) {
+	ctx := context.Background()
+	graph := newEdgeTestGraph(t)
+	if err := graph.UpsertNode(types.Entity{Name: "ALICE", Type: "PERSON", Description: "A cryptographer."}); err != nil {
+		t.Fatal(err)
+	}
+	fake := llmtest.NewFakeLLM().On("summarize_entity_descriptions", " A cryptographer from Paris. ")
+	policy := &SummarizeNodeUpsertPolicy{Config: SummarizeNodeUpsertPolicyConfig{MaxNodeDescriptionSize: 8}}
+
+	// A description within 8 tokens, or 32 characters, is concatenated.
+	err := policy.UpsertNodes(ctx, fake, graph, []types.Entity{
+		{Name: "ALICE", Type: "PERSON", Description: "Lives in Paris."},
+		{Name: "BOB", Type: "PERSON", Description: "A spy."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node, _ := graph.GetNode("ALICE"); node.Description != "A cryptographer.\nLives in Paris." {
+		t.Errorf("got description %q, want the concatenated descriptions", node.Description)
+	}
+	if node, _ := graph.GetNode("BOB"); node.Description != "A spy." {
+		t.Errorf("got description %q, want A spy.", node.Description)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("got calls %v, want none within the size", calls)
+	}
+
+	// A longer description is summarized once.
+	err = policy.UpsertNodes(ctx, fake, graph, []types.Entity{
+		{Name: "ALICE", Type: "PERSON", Description: "Was born in Paris."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 || calls[0].Config.PromptKey != "summarize_entity_descriptions" {
+		t.Fatalf("got calls %v, want one to summarize the description", calls)
+	}
+	if !strings.Contains(calls[0].Prompt, "Was born in Paris.") {
+		t.Errorf("the prompt %q misses the new description", calls[0].Prompt)
+	}
+	if node, _ := graph.GetNode("ALICE"); node.Description != "A cryptographer from Paris." {
+		t.Errorf("got description %q, want the summary", node.Description)
+	}
+
+	// The errors of the LLM are returned, and the node is left unchanged.
+	errSummary := errors.New("scripted error")
+	failing := llmtest.NewFakeLLM().Add(llmtest.Rule{PromptKey: "summarize_entity_descriptions", Err: errSummary})
+	err = policy.UpsertNodes(ctx, failing, graph, []types.Entity{
+		{Name: "ALICE", Type: "PERSON", Description: "Works with Bob on ciphers."},
+	})
+	if !errors.Is(err, errSummary) {
+		t.Errorf("got %v, want the error of the LLM", err)
+	}
+	if node, _ := graph.GetNode("ALICE"); node.Description != "A cryptographer from Paris." {
+		t.Errorf("got description %q after a failed summary", node.Description)
+	}
+}
+
+func TestMergeSimilarEdgeUpsertPolicy(t *testing.T) {
+	ctx := context.Background()
+	embedder := &vectorEmbedder{vectors: map[string][]float32{
+		"trusts":        {1, 0},
+		"relies on":     {0.99, 0.1},
+		"sends keys to": {0, 1},
+	}}
+	graph := newEdgeTestGraph(t,
+		types.Relation{Source: "ALICE", Target: "BOB", Description: "trusts", Chunks: []uint64{1}},
+		types.Relation{Source: "ALICE", Target: "BOB", Description: "sends keys to", Chunks: []uint64{2}},
+	)
+	fake := llmtest.NewFakeLLM().On("edges_group_similar", EdgeMergeResult{
+		Groups: []EdgeMergeGroup{{IDs: []int{0, 1}, Description: "trusts"}},
+	})
+	policy := NewMergeSimilarEdgeUpsertPolicy(embedder)
+
+	// The reversed relation repeating a description only adds its chunks.
+	err := policy.UpsertEdges(ctx, fake, graph, []types.Relation{
+		{Source: "BOB", Target: "ALICE", Description: "relies on", Chunks: []uint64{4, 3}},
+		{Source: "ALICE", Target: "BOB", Description: "relies on", Chunks: []uint64{3}},
+		{Source: "ALICE", Target: "CAROL", Description: "knows", Chunks: []uint64{5}},
+		{Source: "ALICE", Target: "EVE", Description: "is spied on by", Chunks: []uint64{6}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The similar relations are merged into the stored one with the merged
+	// description, which keeps the chunks of both.
+	calls := fake.Calls()
+	if len(calls) != 1 || calls[0].Config.PromptKey != "edges_group_similar" {
+		t.Fatalf("got calls %v, want one to group the relations of ALICE and BOB", calls)
+	}
+	want := map[string][]uint64{"trusts": {1, 3, 4}, "sends keys to": {2}}
+	got := edgeChunks(graph, "ALICE", "BOB")
+	if len(got) != len(want) {
+		t.Fatalf("got relations %v, want %v", got, want)
+	}
+	for description, chunks := range want {
+		if !slices.Equal(got[description], chunks) {
+			t.Errorf("%q: got chunks %v, want %v", description, got[description], chunks)
+		}
+	}
+	if chunks := edgeChunks(graph, "ALICE", "CAROL"); !slices.Equal(chunks["knows"], []uint64{5}) {
+		t.Errorf("got relations %v between ALICE and CAROL", chunks)
+	}
+	if graph.EdgeCount() != 3 {
+		t.Errorf("got %d relations, want the one to the unknown EVE dropped", graph.EdgeCount())
+	}
+
+	// The stored relations are not embedded again, and without a similar
+	// new relation the LLM is not asked.
+	embedded := len(embedder.embedded)
+	embedder.vectors["is close to"] = []float32{-1, 0}
+	err = policy.UpsertEdges(ctx, fake, graph, []types.Relation{
+		{Source: "ALICE", Target: "BOB", Description: "is close to", Chunks: []uint64{7}},
+		{Source: "ALICE", Target: "BOB", Description: "sends keys to", Chunks: []uint64{8}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added := embedder.embedded[embedded:]; !slices.Equal(added, []string{"is close to"}) {
+		t.Errorf("embedded %q, want only the new description", added)
+	}
+	if len(fake.Calls()) != 1 {
+		t.Errorf("got %d calls, want no call without similar relations", len(fake.Calls()))
+	}
+	got = edgeChunks(graph, "ALICE", "BOB")
+	if len(got) != 3 || !slices.Equal(got["sends keys to"], []uint64{2, 8}) || !slices.Equal(got["trusts"], []uint64{1, 3, 4}) {
+		t.Errorf("got relations %v", got)
+	}
+}
+
+func TestMergeSimilarEdgeUpsertPolicyMergedDescriptionCollision(t *testing.T) {
+	ctx := context.Background()
+	embedder := &vectorEmbedder{vectors: map[string][]float32{
+		"trusts":     {1, 0},
+		"relies on":  {0.99, 0.1},
+		"depends on": {0, 1},
+	}}
+	graph := newEdgeTestGraph(t,
+		types.Relation{Source: "ALICE", Target: "BOB", Description: "trusts", Chunks: []uint64{1}},
+		types.Relation{Source: "ALICE", Target: "BOB", Description: "depends on", Chunks: []uint64{2}},
+	)
+	// The similar relations are merged into the description of the other
+	// stored relation.
+	fake := llmtest.NewFakeLLM().On("edges_group_similar", EdgeMergeResult{
+		Groups: []EdgeMergeGroup{{IDs: []int{0, 1}, Description: "depends on"}},
+	})
+	policy := NewMergeSimilarEdgeUpsertPolicy(embedder)
+
+	err := policy.UpsertEdges(ctx, fake, graph, []types.Relation{
+		{Source: "ALICE", Target: "BOB", Description: "relies on", Chunks: []uint64{3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edges := graph.GetEdges("ALICE", "BOB")
+	if len(edges) != 1 || edges[0].Description != "depends on" || !slices.Equal(edges[0].Chunks, []uint64{1, 2, 3}) {
+		t.Errorf("got relations %+v, want depends on with the chunks of all", edges)
+	}
+}
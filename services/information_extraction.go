@@ -3,25 +3,22 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
-	"reflect"
+	"maps"
+	"slices"
 	"strings"
 	"sync"
 
 	"github.com/binarycraft007/fast-graphrag-go/llms"
 	"github.com/binarycraft007/fast-graphrag-go/prompts"
+	"github.com/binarycraft007/fast-graphrag-go/storage"
 	"github.com/binarycraft007/fast-graphrag-go/types"
 )
 
-// BaseGraphStorage defines the interface for graph storage.
-type BaseGraphStorage[Node, Edge, ID any] interface {
-	InsertStart() error
-	InsertDone() error
-}
-
 // BaseGraphUpsertPolicy defines the interface for graph upserting logic.
 type BaseGraphUpsertPolicy[Node, Edge, ID any] interface {
-	Upsert(llm llms.LLMService, storage BaseGraphStorage[Node, Edge, ID], nodes []Node, edges []Edge) error
+	Upsert(ctx context.Context, llm llms.ChatModel, graph storage.BaseGraphStorage[Node, Edge, ID], nodes []Node, edges []Edge) error
 }
 
 // GleaningStatus represents the status of gleaning.
@@ -36,25 +33,56 @@ type GleaningStatus struct {
 	Status Status `json:"status"`
 }
 
+// Validate checks that the status is Done or Continue.
+func (g *GleaningStatus) Validate() error {
+	if g.Status != Done && g.Status != Continue {
+		return fmt.Errorf("unknown gleaning status %q", g.Status)
+	}
+	return nil
+}
+
+// Kinds of entities extracted from a query, stored in types.Entity.Type.
+const (
+	NamedQueryEntity   = "NAMED"
+	GenericQueryEntity = "GENERIC"
+)
+
+// QueryEntities are the entities the LLM extracted from a query.
+type QueryEntities struct {
+	Named   []string `json:"named"`
+	Generic []string `json:"generic"`
+}
+
+// ExtractionResult is the graph extracted from a document, or the error
+// that stopped its extraction.
+type ExtractionResult[Node, Edge, ID any] struct {
+	Graph storage.BaseGraphStorage[Node, Edge, ID]
+	Err   error
+}
+
 // BaseInformationExtractionService defines the base for information extraction services.
 type BaseInformationExtractionService[Chunk, Node, Edge, ID any] struct {
 	GraphUpsert      BaseGraphUpsertPolicy[Node, Edge, ID]
 	MaxGleaningSteps int
+	// MaxConcurrentChunks is the maximum number of chunks extracted at a
+	// time by a call of Extract, across all documents. Zero is unlimited.
+	MaxConcurrentChunks int
 }
 
 // Extract extracts entities and relationships from documents.
 func (s *BaseInformationExtractionService[Chunk, Node, Edge, ID]) Extract(
-	llm llms.LLMService,
+	ctx context.Context,
+	llm llms.ChatModel,
 	documents [][]Chunk,
 	promptArgs map[string]string,
 	entityTypes []string,
-) ([]chan *BaseGraphStorage[Node, Edge, ID], error) {
+) ([]chan ExtractionResult[Node, Edge, ID], error) {
 	return nil, errors.New("not implemented")
 }
 
 // ExtractEntitiesFromQuery extracts entities from a query string.
 func (s *BaseInformationExtractionService[Chunk, Node, Edge, ID]) ExtractEntitiesFromQuery(
-	llm llms.LLMService, query string, promptArgs map[string]string,
+	ctx context.Context, llm llms.ChatModel, query string, promptArgs map[string]string,
 ) ([]types.Entity, error) {
 	return nil, errors.New("not implemented")
 }
@@ -64,33 +92,76 @@ type DefaultInformationExtractionService struct {
 	BaseInformationExtractionService[types.Chunk, types.Entity, types.Relation, string]
 }
 
-// Extract extracts both entities and relationships.
+// Extract extracts both entities and relationships. The token usage is
+// recorded in the llms.UsageTracker of ctx, if any, per operation and per
+// document as labeled by DocumentLabel.
 func (s *DefaultInformationExtractionService) Extract(
-	llm llms.LLMService,
+	ctx context.Context,
+	llm llms.ChatModel,
 	documents [][]types.Chunk,
 	promptArgs map[string]any,
 	entityTypes []string,
-) ([]chan *BaseGraphStorage[types.Entity, types.Relation, string], error) {
-	results := make([]chan *BaseGraphStorage[types.Entity, types.Relation, string], len(documents))
+) ([]chan ExtractionResult[types.Entity, types.Relation, string], error) {
+	var slots chan struct{}
+	if s.MaxConcurrentChunks > 0 {
+		slots = make(chan struct{}, s.MaxConcurrentChunks)
+	}
+	results := make([]chan ExtractionResult[types.Entity, types.Relation, string], len(documents))
 	for i, document := range documents {
-		results[i] = make(chan *BaseGraphStorage[types.Entity, types.Relation, string], 1)
-		go func(doc []types.Chunk, result chan *BaseGraphStorage[types.Entity, types.Relation, string]) {
-			graph, err := s.extractChunks(llm, doc, promptArgs, entityTypes)
-			if err != nil {
-				log.Println("Error extracting chunks:", err)
-				close(result)
-				return
-			}
-			result <- graph
+		results[i] = make(chan ExtractionResult[types.Entity, types.Relation, string], 1)
+		go func(ctx context.Context, doc []types.Chunk, result chan ExtractionResult[types.Entity, types.Relation, string]) {
+			graph, err := s.extractChunks(ctx, llm, doc, promptArgs, entityTypes, slots)
+			result <- ExtractionResult[types.Entity, types.Relation, string]{Graph: graph, Err: err}
 			close(result)
-		}(document, results[i])
+		}(llms.WithDocument(ctx, DocumentLabel(i, document)), document, results[i])
 	}
 	return results, nil
 }
 
+// ExtractEntitiesFromQuery extracts the named and generic entities of a
+// query. The type of the returned entities is NamedQueryEntity or
+// GenericQueryEntity and their names are normalized like graph entities.
+func (s *DefaultInformationExtractionService) ExtractEntitiesFromQuery(
+	ctx context.Context, llm llms.ChatModel, query string, promptArgs map[string]any,
+) ([]types.Entity, error) {
+	promptArgsCopy := maps.Clone(promptArgs)
+	if promptArgsCopy == nil {
+		promptArgsCopy = make(map[string]any)
+	}
+	promptArgsCopy["query"] = query
+
+	queryEntities, err := llms.FormatAndGenerate[QueryEntities](
+		ctx,
+		"entity_extraction_query",
+		llm,
+		promptArgsCopy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var entities []types.Entity
+	seen := make(map[string]bool)
+	add := func(names []string, entityType string) {
+		for _, name := range names {
+			name = normalizeEntityName(name)
+			if name != "" && !seen[name] {
+				seen[name] = true
+				entities = append(entities, types.Entity{Name: name, Type: entityType})
+			}
+		}
+	}
+	add(queryEntities.Named, NamedQueryEntity)
+	add(queryEntities.Generic, GenericQueryEntity)
+	return entities, nil
+}
+
+// extractChunks extracts the graphs of chunks concurrently, taking a slot
+// of slots per chunk if slots is not nil, and merges them.
 func (s *DefaultInformationExtractionService) extractChunks(
-	llm llms.LLMService, chunks []types.Chunk, promptArgs map[string]any, entityTypes []string,
-) (*BaseGraphStorage[types.Entity, types.Relation, string], error) {
+	ctx context.Context, llm llms.ChatModel, chunks []types.Chunk, promptArgs map[string]any, entityTypes []string,
+	slots chan struct{},
+) (storage.BaseGraphStorage[types.Entity, types.Relation, string], error) {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	chunkResults := make([]*types.Graph, len(chunks))
@@ -100,8 +171,20 @@ func (s *DefaultInformationExtractionService) extractChunks(
 	for i, chunk := range chunks {
 		go func(idx int, c types.Chunk) {
 			defer wg.Done()
-			log.Println("extracting chunk:", c.ID)
-			graph, err := s.extractChunk(llm, c, promptArgs, entityTypes)
+			var err error
+			var graph *types.Graph
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+					defer func() { <-slots }()
+				case <-ctx.Done():
+					err = ctx.Err()
+				}
+			}
+			if err == nil {
+				log.Println("extracting chunk:", c.ID)
+				graph, err = s.extractChunk(ctx, llm, c, promptArgs, entityTypes)
+			}
 			mu.Lock()
 			if err != nil {
 				errors = append(errors, err)
@@ -121,26 +204,30 @@ func (s *DefaultInformationExtractionService) extractChunks(
 }
 
 func (s *DefaultInformationExtractionService) extractChunk(
-	llm llms.LLMService, chunk types.Chunk, promptArgs map[string]any, entityTypes []string,
+	ctx context.Context, llm llms.ChatModel, chunk types.Chunk, promptArgs map[string]any, entityTypes []string,
 ) (*types.Graph, error) {
-	promptArgsCopy := promptArgs
+	promptArgsCopy := maps.Clone(promptArgs)
+	if promptArgsCopy == nil {
+		promptArgsCopy = make(map[string]any)
+	}
 	promptArgsCopy["input_text"] = chunk.Content
 	promptArgsCopy["entity_relationship_extraction"] = prompts.EntityRelationshipExtractionExample
 
-	ctx := context.Background()
-	chunkGraph, err := llms.FormatAndSendPrompt(
-		ctx,
+	// The extraction and the gleaning share a session, so the gleaning
+	// prompts see the chunk and the entities found so far.
+	session := llm.StartChat()
+	chunkGraph, err := llms.FormatAndGenerate[types.Graph](
+		llms.WithOperation(ctx, OperationExtraction),
 		"entity_relationship_extraction",
-		llm,
+		session,
 		promptArgsCopy,
-		llms.WithResponseType(reflect.TypeOf(types.Graph{})),
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	// Glean additional details if necessary
-	finalGraph, err := s.gleaning(ctx, llm, chunkGraph.(*types.Graph))
+	finalGraph, err := s.gleaning(llms.WithOperation(ctx, OperationGleaning), session, &chunkGraph)
 	if err != nil {
 		return nil, err
 	}
@@ -155,42 +242,81 @@ func (s *DefaultInformationExtractionService) extractChunk(
 	for i := range finalGraph.Relationships {
 		finalGraph.Relationships[i].Chunks = append(finalGraph.Relationships[i].Chunks, chunk.ID)
 	}
+	for i := range finalGraph.OtherRelationships {
+		finalGraph.OtherRelationships[i].Chunks = append(finalGraph.OtherRelationships[i].Chunks, chunk.ID)
+	}
 
 	return finalGraph, nil
 }
 
+// gleaning asks the model of session for the entities and relationships it
+// missed, until it reports it is done or MaxGleaningSteps rounds have run.
+// Gleaned entities and relationships which were already found are dropped.
 func (s *DefaultInformationExtractionService) gleaning(
-	ctx context.Context, llm llms.LLMService, initialGraph *types.Graph,
+	ctx context.Context, session *llms.ChatSession, initialGraph *types.Graph,
 ) (*types.Graph, error) {
 	currentGraph := initialGraph
+	entities := make(map[string]bool)
+	relations := make(map[[3]string]bool)
+	// Relations are undirected, so the endpoints are ordered in the key.
+	relationKey := func(relation types.Relation) [3]string {
+		source, target := normalizeEntityName(relation.Source), normalizeEntityName(relation.Target)
+		if target < source {
+			source, target = target, source
+		}
+		return [3]string{source, target, strings.TrimSpace(relation.Description)}
+	}
+	addEntities := func(gleaned []types.Entity) {
+		for _, entity := range gleaned {
+			name := normalizeEntityName(entity.Name)
+			if !entities[name] {
+				entities[name] = true
+				currentGraph.Entities = append(currentGraph.Entities, entity)
+			}
+		}
+	}
+	addRelations := func(graphRelations *[]types.Relation, gleaned []types.Relation) {
+		for _, relation := range gleaned {
+			if key := relationKey(relation); !relations[key] {
+				relations[key] = true
+				*graphRelations = append(*graphRelations, relation)
+			}
+		}
+	}
+	for _, entity := range currentGraph.Entities {
+		entities[normalizeEntityName(entity.Name)] = true
+	}
+	for _, relation := range slices.Concat(currentGraph.Relationships, currentGraph.OtherRelationships) {
+		relations[relationKey(relation)] = true
+	}
 
 	for step := 0; step < s.MaxGleaningSteps; step++ {
-		result, err := llms.FormatAndSendPrompt(
+		gleaningResult, err := llms.FormatAndGenerate[types.Graph](
 			ctx, "entity_relationship_continue_extraction",
-			llm, map[string]string{},
-			llms.WithResponseType(reflect.TypeOf(types.Graph{})),
+			session, map[string]string{},
 		)
 		if err != nil {
 			log.Println("Gleaning error:", err)
 			return nil, err
 		}
-		gleaningResult := result.(*types.Graph)
 
-		currentGraph.Entities = append(currentGraph.Entities, gleaningResult.Entities...)
-		currentGraph.Relationships = append(currentGraph.Relationships, gleaningResult.Relationships...)
+		addEntities(gleaningResult.Entities)
+		addRelations(&currentGraph.Relationships, gleaningResult.Relationships)
+		addRelations(&currentGraph.OtherRelationships, gleaningResult.OtherRelationships)
+		if step == s.MaxGleaningSteps-1 {
+			break
+		}
 
-		status, err := llms.FormatAndSendPrompt(
+		gleaningStatus, err := llms.FormatAndGenerate[GleaningStatus](
 			ctx, "entity_relationship_gleaning_done_extraction",
-			llm, map[string]string{},
-			llms.WithResponseType(reflect.TypeOf(GleaningStatus{})),
+			session, map[string]string{},
 		)
 		if err != nil {
 			log.Println("Gleaning status error:", err)
 			return nil, err
 		}
-		gleaningStatus := status.(*GleaningStatus)
 
-		if gleaningStatus.Status == "done" {
+		if gleaningStatus.Status == Done {
 			break
 		}
 	}
@@ -198,11 +324,131 @@ func (s *DefaultInformationExtractionService) gleaning(
 	return currentGraph, nil
 }
 
+// mergeGraphs unions the per-chunk graphs into a new graph storage. Entities
+// are deduplicated by normalized name, and relations between the same
+// entities with the same description are merged, accumulating their chunks.
+// The result only depends on the order of graphs, which follows the order of
+// the chunks, so it is deterministic regardless of which extraction finished first.
 func (s *DefaultInformationExtractionService) mergeGraphs(
-	llm llms.LLMService, graphs []*types.Graph,
-) (*BaseGraphStorage[types.Entity, types.Relation, string], error) {
-	// Simulate graph merging logic
-	return nil, nil
+	llm llms.ChatModel, graphs []*types.Graph,
+) (storage.BaseGraphStorage[types.Entity, types.Relation, string], error) {
+	var entities []*mergedEntity
+	entityIndex := make(map[string]*mergedEntity)
+	for _, graph := range graphs {
+		if graph == nil {
+			continue
+		}
+		for _, entity := range graph.Entities {
+			name := normalizeEntityName(entity.Name)
+			if name == "" {
+				continue
+			}
+			merged, ok := entityIndex[name]
+			if !ok {
+				merged = newMergedEntity(name)
+				entityIndex[name] = merged
+				entities = append(entities, merged)
+			}
+			merged.add(entity)
+		}
+	}
+
+	type relationKey struct {
+		source, target, description string
+	}
+	var relations []*types.Relation
+	relationIndex := make(map[relationKey]*types.Relation)
+	for _, graph := range graphs {
+		if graph == nil {
+			continue
+		}
+		for _, relation := range slices.Concat(graph.Relationships, graph.OtherRelationships) {
+			relation.Source = normalizeEntityName(relation.Source)
+			relation.Target = normalizeEntityName(relation.Target)
+			relation.Description = strings.TrimSpace(relation.Description)
+			if entityIndex[relation.Source] == nil || entityIndex[relation.Target] == nil {
+				continue
+			}
+			key := relationKey{relation.Source, relation.Target, relation.Description}
+			if relation.Target < relation.Source {
+				key.source, key.target = key.target, key.source
+			}
+			if merged, ok := relationIndex[key]; ok {
+				merged.Chunks = append(merged.Chunks, relation.Chunks...)
+				continue
+			}
+			relation.Chunks = slices.Clone(relation.Chunks)
+			relationIndex[key] = &relation
+			relations = append(relations, &relation)
+		}
+	}
+
+	graph := storage.NewMemoryGraphStorage()
+	if err := graph.InsertStart(); err != nil {
+		return nil, err
+	}
+	for _, entity := range entities {
+		if err := graph.UpsertNode(entity.entity()); err != nil {
+			return nil, err
+		}
+	}
+	for _, relation := range relations {
+		relation.Chunks = unionChunks(relation.Chunks)
+		if err := graph.UpsertEdge(*relation); err != nil {
+			return nil, err
+		}
+	}
+	if err := graph.InsertDone(); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// mergedEntity accumulates the occurrences of an entity across chunks.
+type mergedEntity struct {
+	name         string
+	descriptions []string
+	typeCounts   map[string]int
+}
+
+func newMergedEntity(name string) *mergedEntity {
+	return &mergedEntity{name: name, typeCounts: make(map[string]int)}
+}
+
+// add records the type of entity and every description line not seen yet.
+func (m *mergedEntity) add(entity types.Entity) {
+	m.typeCounts[entity.Type]++
+	for _, line := range strings.Split(entity.Description, "\n") {
+		description := strings.TrimSpace(line)
+		if description != "" && !slices.Contains(m.descriptions, description) {
+			m.descriptions = append(m.descriptions, description)
+		}
+	}
+}
+
+// entity combines the descriptions and picks the most frequent known type,
+// breaking ties alphabetically.
+func (m *mergedEntity) entity() types.Entity {
+	entityType, count := "UNKNOWN", 0
+	for t, c := range m.typeCounts {
+		if t == "UNKNOWN" || t == "" {
+			continue
+		}
+		if c > count || (c == count && t < entityType) {
+			entityType, count = t, c
+		}
+	}
+	return types.Entity{
+		Name:        m.name,
+		Type:        entityType,
+		Description: strings.Join(m.descriptions, "\n"),
+	}
+}
+
+// normalizeEntityName upper-cases name and collapses its whitespace so that
+// different spellings of the same entity share one node.
+func normalizeEntityName(name string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(name), " "))
 }
 
 func (s *DefaultInformationExtractionService) cleanEntityTypes(entityTypes []string) map[string]bool {
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+	"github.com/binarycraft007/fast-graphrag-go/llms/llmtest"
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+func TestMergeGraphs(t *testing.T) {
+	graphs := []*types.Graph{
+		{
+			Entities: []types.Entity{
+				{Name: "Alice", Type: "PERSON", Description: "A cryptographer."},
+				{Name: "Bob", Type: "PERSON", Description: "Talks to Alice."},
+			},
+			Relationships: []types.Relation{
+				{Source: "Alice", Target: "Bob", Description: "sends keys to", Chunks: []uint64{1}},
+				{Source: "Alice", Target: "Eve", Description: "is spied on by", Chunks: []uint64{1}},
+			},
+		},
+		nil,
+		{
+			Entities: []types.Entity{
+				{Name: " alice ", Type: "UNKNOWN", Description: "A cryptographer.\nLives in Paris."},
+				{Name: "bob", Type: "LOCATION", Description: "Talks to Alice."},
+				{Name: "Bob", Type: "PERSON"},
+			},
+			Relationships: []types.Relation{
+				{Source: "bob", Target: "alice", Description: " sends keys to ", Chunks: []uint64{2, 1}},
+			},
+			OtherRelationships: []types.Relation{
+				{Source: "Alice", Target: "Bob", Description: "trusts", Chunks: []uint64{2}},
+			},
+		},
+	}
+
+	s := &DefaultInformationExtractionService{}
+	graph, err := s.mergeGraphs(nil, graphs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantEntities := []types.Entity{
+		{Name: "ALICE", Type: "PERSON", Description: "A cryptographer.\nLives in Paris."},
+		{Name: "BOB", Type: "PERSON", Description: "Talks to Alice."},
+	}
+	for _, want := range wantEntities {
+		got, ok := graph.GetNode(want.Name)
+		if !ok || got != want {
+			t.Errorf("got entity %+v, want %+v", got, want)
+		}
+	}
+	if graph.NodeCount() != len(wantEntities) {
+		t.Errorf("got %d entities, want %d", graph.NodeCount(), len(wantEntities))
+	}
+
+	// The relations to the unknown entity EVE are dropped, the reversed
+	// duplicate of "sends keys to" is merged.
+	edges := graph.GetEdges("ALICE", "BOB")
+	if len(edges) != 2 || graph.EdgeCount() != 2 {
+		t.Fatalf("got relations %+v, want sends keys to and trusts", edges)
+	}
+	for _, edge := range edges {
+		var want []uint64
+		switch edge.Description {
+		case "sends keys to":
+			want = []uint64{1, 2}
+		case "trusts":
+			want = []uint64{2}
+		default:
+			t.Fatalf("unexpected relation %+v", edge)
+		}
+		if !slices.Equal(edge.Chunks, want) {
+			t.Errorf("relation %q has chunks %v, want %v", edge.Description, edge.Chunks, want)
+		}
+	}
+}
+
+func TestExtractError(t *testing.T) {
+	errExtraction := errors.New("extraction failed")
+	llm := llmtest.NewFakeLLM().
+		Add(llmtest.Rule{Pattern: regexp.MustCompile("broken chunk"), Err: errExtraction}).
+		On("entity_relationship_extraction", types.Graph{Entities: []types.Entity{{Name: "Alice", Type: "PERSON"}}})
+	documents := [][]types.Chunk{
+		{{ID: 1, Content: "Alice."}},
+		{{ID: 2, Content: "Alice."}, {ID: 3, Content: "A broken chunk."}},
+	}
+
+	s := &DefaultInformationExtractionService{}
+	results, err := s.Extract(context.Background(), llm, documents, map[string]any{}, []string{"PERSON"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(documents) {
+		t.Fatalf("got %d results for %d documents", len(results), len(documents))
+	}
+	first := <-results[0]
+	if first.Err != nil || first.Graph.NodeCount() != 1 {
+		t.Errorf("got %v, want the graph of the first document", first.Err)
+	}
+	if second := <-results[1]; !errors.Is(second.Err, errExtraction) {
+		t.Errorf("got %v, want the extraction error", second.Err)
+	}
+}
+
+func TestExtractMaxConcurrentChunks(t *testing.T) {
+	var running, peak atomic.Int32
+	llm := llmtest.NewFakeLLM().Add(llmtest.Rule{
+		PromptKey: "entity_relationship_extraction",
+		Respond: func(prompt string, config llms.MessageConfig) (any, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(10 * time.Millisecond)
+			return types.Graph{}, nil
+		},
+	})
+	var documents [][]types.Chunk
+	for i := range 3 {
+		var chunks []types.Chunk
+		for j := range 4 {
+			chunks = append(chunks, types.Chunk{ID: uint64(4*i + j)})
+		}
+		documents = append(documents, chunks)
+	}
+
+	s := &DefaultInformationExtractionService{}
+	s.MaxConcurrentChunks = 2
+	results, err := s.Extract(context.Background(), llm, documents, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if extracted := <-result; extracted.Err != nil {
+			t.Fatal(extracted.Err)
+		}
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d chunks extracted at a time, want at most 2", p)
+	}
+	if calls := len(llm.Calls()); calls != 12 {
+		t.Errorf("got %d calls, want one per chunk", calls)
+	}
+}
+
+func TestExtractGleaning(t *testing.T) {
+	llm := llmtest.NewFakeLLM().
+		On("entity_relationship_extraction", types.Graph{
+			Entities:      []types.Entity{{Name: "Alice", Type: "PERSON"}, {Name: "Bob", Type: "PERSON"}},
+			Relationships: []types.Relation{{Source: "Alice", Target: "Bob", Description: "works with"}},
+		}).
+		Add(llmtest.Rule{PromptKey: "entity_relationship_continue_extraction", Times: 1, Response: types.Graph{
+			Entities: []types.Entity{{Name: "Carol", Type: "PERSON"}},
+			Relationships: []types.Relation{
+				{Source: "bob", Target: "alice", Description: "works with"},
+				{Source: "Alice", Target: "Carol", Description: "knows"},
+			},
+		}}).
+		On("entity_relationship_continue_extraction", types.Graph{
+			Entities:      []types.Entity{{Name: " alice ", Type: "PERSON"}},
+			Relationships: []types.Relation{{Source: "Carol", Target: "Alice", Description: " knows "}},
+		}).
+		On("entity_relationship_gleaning_done_extraction", GleaningStatus{Status: Continue})
+
+	s := &DefaultInformationExtractionService{}
+	s.MaxGleaningSteps = 2
+	graph, err := s.extractChunk(context.Background(), llm, types.Chunk{ID: 1, Content: "Alice works with Bob."}, nil, []string{"PERSON"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The gleaning prompts continue the session of the extraction, and the
+	// last step does not ask whether to continue.
+	wantKeys := []string{
+		"entity_relationship_extraction",
+		"entity_relationship_continue_extraction",
+		"entity_relationship_gleaning_done_extraction",
+		"entity_relationship_continue_extraction",
+	}
+	calls := llm.Calls()
+	if len(calls) != len(wantKeys) {
+		t.Fatalf("got %d calls, want %d", len(calls), len(wantKeys))
+	}
+	for i, call := range calls {
+		if call.Config.PromptKey != wantKeys[i] {
+			t.Errorf("call %d: got prompt %q, want %q", i, call.Config.PromptKey, wantKeys[i])
+		}
+		if history := call.Config.HistoryMessages; len(history) != 2*i {
+			t.Errorf("call %d: got %d history messages, want %d", i, len(history), 2*i)
+		}
+	}
+	if history := calls[1].Config.HistoryMessages; len(history) > 0 {
+		if first, ok := history[0].(llms.ChatMessage); !ok || first.Content != calls[0].Prompt {
+			t.Errorf("got history %v, want the extraction prompt first", history)
+		}
+	}
+
+	// The gleaned duplicates, reversed or renamed, are dropped.
+	if len(graph.Entities) != 3 {
+		t.Errorf("got entities %+v, want Alice, Bob and Carol", graph.Entities)
+	}
+	var descriptions []string
+	for _, relation := range graph.Relationships {
+		descriptions = append(descriptions, relation.Description)
+	}
+	if !slices.Equal(descriptions, []string{"works with", "knows"}) {
+		t.Errorf("got relations %+v, want works with and knows", graph.Relationships)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"iter"
+	"maps"
+	"strings"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// queryPromptKey is the prompt answering a query from its context.
+const queryPromptKey = "generate_response_query"
+
+// QueryResponse is the answer to a query together with the context it is based on.
+type QueryResponse struct {
+	Response string
+	Entities []types.Entity
+	Context  *QueryContext
+}
+
+// DefaultQueryService answers queries over the state built at insertion.
+type DefaultQueryService struct {
+	Extraction *DefaultInformationExtractionService
+	State      *DefaultStateManagerService
+}
+
+// Query extracts the entities of query, retrieves the related context from
+// the state and lets the LLM answer the query from that context.
+func (s *DefaultQueryService) Query(
+	ctx context.Context, llm llms.ChatModel, query string, promptArgs map[string]any,
+) (*QueryResponse, error) {
+	ctx = llms.WithOperation(ctx, OperationQuery)
+	queryResponse, prompt, err := s.prepare(ctx, llm, query, promptArgs)
+	if err != nil {
+		return nil, err
+	}
+	response, err := llms.Generate[string](ctx, llm, prompt, llms.WithPromptKey(queryPromptKey))
+	if err != nil {
+		return nil, err
+	}
+	queryResponse.Response = strings.TrimSpace(response)
+	return queryResponse, nil
+}
+
+// QueryStream is like Query but streams the answer. The returned response
+// holds the entities and the context, its Response is left empty.
+func (s *DefaultQueryService) QueryStream(
+	ctx context.Context, llm llms.ChatModel, query string, promptArgs map[string]any,
+) (*QueryResponse, iter.Seq2[llms.StreamChunk, error], error) {
+	ctx = llms.WithOperation(ctx, OperationQuery)
+	queryResponse, prompt, err := s.prepare(ctx, llm, query, promptArgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return queryResponse, llms.Stream(ctx, llm, prompt, llms.WithPromptKey(queryPromptKey)), nil
+}
+
+// prepare retrieves the context of query and formats the prompt answering it.
+func (s *DefaultQueryService) prepare(
+	ctx context.Context, llm llms.ChatModel, query string, promptArgs map[string]any,
+) (*QueryResponse, string, error) {
+	entities, err := s.Extraction.ExtractEntitiesFromQuery(ctx, llm, query, promptArgs)
+	if err != nil {
+		return nil, "", err
+	}
+	queryContext, err := s.State.GetContext(ctx, entities)
+	if err != nil {
+		return nil, "", err
+	}
+
+	promptArgsCopy := maps.Clone(promptArgs)
+	if promptArgsCopy == nil {
+		promptArgsCopy = make(map[string]any)
+	}
+	promptArgsCopy["query"] = query
+	promptArgsCopy["context"] = queryContext.String()
+	prompt, err := llms.FormatPrompt(queryPromptKey, promptArgsCopy)
+	if err != nil {
+		return nil, "", err
+	}
+	return &QueryResponse{Entities: entities, Context: queryContext}, prompt, nil
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/binarycraft007/fast-graphrag-go/llms"
+	"github.com/binarycraft007/fast-graphrag-go/storage"
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// DefaultStateManagerServiceConfig configures the retrieval of query context.
+type DefaultStateManagerServiceConfig struct {
+	// EntitySimilarityThreshold is the minimum cosine similarity for linking
+	// a query entity to a graph entity.
+	EntitySimilarityThreshold float32
+	// EntitiesPerGenericEntity is the number of graph entities a generic
+	// query entity is linked to. Named query entities link to one entity.
+	EntitiesPerGenericEntity int
+	TopEntities              int
+	TopRelations             int
+	TopChunks                int
+	PageRank                 storage.PageRankConfig
+}
+
+// NewDefaultStateManagerServiceConfig returns the default configuration.
+func NewDefaultStateManagerServiceConfig() DefaultStateManagerServiceConfig {
+	return DefaultStateManagerServiceConfig{
+		EntitySimilarityThreshold: 0.8,
+		EntitiesPerGenericEntity:  5,
+		TopEntities:               32,
+		TopRelations:              64,
+		TopChunks:                 8,
+		PageRank:                  storage.DefaultPageRankConfig(),
+	}
+}
+
+// DefaultStateManagerService owns the graph, the entity embeddings and the
+// chunks, keeps them consistent on insertion and retrieves context for queries.
+type DefaultStateManagerService struct {
+	Config      DefaultStateManagerServiceConfig
+	Graph       storage.BaseGraphStorage[types.Entity, types.Relation, string]
+	Entities    storage.BaseVectorStorage[string]
+	Chunks      storage.ChunkStorage
+	GraphUpsert BaseGraphUpsertPolicy[types.Entity, types.Relation, string]
+	Embedder    llms.Embedder
+	// WorkingDir persists the storages when set.
+	WorkingDir *storage.WorkingDir
+
+	metadata *storage.WorkingDirMetadata
+}
+
+// Files of the storages in the working directory.
+const (
+	graphFile    = "graph.bin"
+	entitiesFile = "entities.bin"
+	chunksFile   = "chunks.bin"
+)
+
+// NewDefaultStateManagerService creates a state manager with in-memory
+// storages which embeds entities with embedder.
+func NewDefaultStateManagerService(embedder llms.Embedder) *DefaultStateManagerService {
+	return &DefaultStateManagerService{
+		Config:      NewDefaultStateManagerServiceConfig(),
+		Graph:       storage.NewMemoryGraphStorage(),
+		Entities:    storage.NewMemoryVectorStorage[string](0),
+		Chunks:      storage.NewChunkStorage(),
+		GraphUpsert: NewDefaultGraphUpsertPolicy(),
+		Embedder:    embedder,
+	}
+}
+
+// Load reads the storages from the working directory, if it holds any.
+func (s *DefaultStateManagerService) Load() error {
+	if s.WorkingDir == nil {
+		return nil
+	}
+	metadata, err := s.WorkingDir.LoadMetadata()
+	if err != nil || metadata == nil {
+		return err
+	}
+	s.metadata = metadata
+	for _, file := range s.files() {
+		if _, err := s.WorkingDir.Load(file.name, file.persistable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertStart prepares the storages for an insertion.
+func (s *DefaultStateManagerService) InsertStart() error {
+	return s.Graph.InsertStart()
+}
+
+// InsertDone finalizes an insertion and saves the storages to the working
+// directory. The chunks are saved after the graph and the entities, so a
+// crash in between makes the next insertion process the chunks again rather
+// than losing the entities extracted from them.
+func (s *DefaultStateManagerService) InsertDone() error {
+	if err := s.Graph.InsertDone(); err != nil {
+		return err
+	}
+	if s.WorkingDir == nil {
+		return nil
+	}
+	for _, file := range s.files() {
+		if err := s.WorkingDir.Save(file.name, file.persistable); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	if s.metadata == nil {
+		s.metadata = &storage.WorkingDirMetadata{CreatedAt: now}
+	}
+	s.metadata.FormatVersion = storage.FormatVersion
+	s.metadata.UpdatedAt = now
+	s.metadata.Nodes = s.Graph.NodeCount()
+	s.metadata.Edges = s.Graph.EdgeCount()
+	s.metadata.Entities = s.Entities.Size()
+	s.metadata.Chunks = s.Chunks.Size()
+	return s.WorkingDir.SaveMetadata(*s.metadata)
+}
+
+type storageFile struct {
+	name        string
+	persistable storage.Persistable
+}
+
+// files lists the storages with their files in the order they are saved.
+func (s *DefaultStateManagerService) files() []storageFile {
+	return []storageFile{
+		{graphFile, s.Graph},
+		{entitiesFile, s.Entities},
+		{chunksFile, s.Chunks},
+	}
+}
+
+// FilterNewChunks drops the chunks which have already been inserted.
+func (s *DefaultStateManagerService) FilterNewChunks(documents [][]types.Chunk) [][]types.Chunk {
+	filtered := make([][]types.Chunk, len(documents))
+	for i, chunks := range documents {
+		ids := make([]uint64, len(chunks))
+		for j, chunk := range chunks {
+			ids[j] = chunk.ID
+		}
+		for j, found := range s.Chunks.Has(ids) {
+			if !found {
+				filtered[i] = append(filtered[i], chunks[j])
+			}
+		}
+	}
+	return filtered
+}
+
+// Upsert merges a graph extracted from chunks into the state, embeds its new
+// entities and stores the chunks. Chunks whose metadata cannot be saved are
+// rejected before the state is changed.
+func (s *DefaultStateManagerService) Upsert(
+	ctx context.Context,
+	llm llms.ChatModel,
+	graph storage.BaseGraphStorage[types.Entity, types.Relation, string],
+	chunks []types.Chunk,
+) error {
+	if err := storage.CheckChunks(chunks); err != nil {
+		return err
+	}
+	nodes := slices.Collect(graph.Nodes())
+	edges := slices.Collect(graph.Edges())
+	if err := s.GraphUpsert.Upsert(ctx, llm, s.Graph, nodes, edges); err != nil {
+		return err
+	}
+
+	var names []string
+	for _, node := range nodes {
+		if _, ok := s.Entities.Get(node.Name); !ok {
+			names = append(names, node.Name)
+		}
+	}
+	if len(names) > 0 {
+		embeddings, err := s.Embedder.GetEmbedding(llms.WithOperation(ctx, OperationEmbedding), names)
+		if err != nil {
+			return err
+		}
+		if len(embeddings) != len(names) {
+			return fmt.Errorf("got %d embeddings for %d entities", len(embeddings), len(names))
+		}
+		vectors := make([][]float32, len(embeddings))
+		for i, embedding := range embeddings {
+			vectors[i] = embedding.Vector
+		}
+		if err := s.Entities.Upsert(names, vectors); err != nil {
+			return err
+		}
+	}
+
+	return storage.UpsertChunks(s.Chunks, chunks)
+}
+
+// ScoredChunk is a chunk ranked by the scores of the relations extracted from it.
+type ScoredChunk struct {
+	Chunk types.Chunk
+	Score float64
+}
+
+// QueryContext is the part of the state relevant to a query.
+type QueryContext struct {
+	Entities  []storage.ScoredEntity
+	Relations []storage.ScoredRelation
+	Chunks    []ScoredChunk
+}
+
+// GetContext links the query entities to graph entities, ranks the graph by
+// personalized PageRank seeded with them and collects the best entities,
+// relations and the chunks the relations were extracted from.
+func (s *DefaultStateManagerService) GetContext(ctx context.Context, queryEntities []types.Entity) (*QueryContext, error) {
+	seeds, err := s.linkEntities(ctx, queryEntities)
+	if err != nil {
+		return nil, err
+	}
+	entities, relations, err := storage.PersonalizedPageRank(s.Graph, seeds, s.Config.PageRank)
+	if err != nil {
+		return nil, err
+	}
+	queryContext := &QueryContext{
+		Entities:  entities[:min(len(entities), s.Config.TopEntities)],
+		Relations: relations[:min(len(relations), s.Config.TopRelations)],
+	}
+
+	chunkScores := make(map[uint64]float64)
+	var chunkIDs []uint64
+	for _, relation := range queryContext.Relations {
+		for _, id := range relation.Relation.Chunks {
+			if _, ok := chunkScores[id]; !ok {
+				chunkIDs = append(chunkIDs, id)
+			}
+			chunkScores[id] += relation.Score
+		}
+	}
+	slices.SortStableFunc(chunkIDs, func(a, b uint64) int {
+		return cmp.Compare(chunkScores[b], chunkScores[a])
+	})
+	for i, chunk := range s.Chunks.Get(chunkIDs) {
+		if chunk == nil {
+			continue
+		}
+		queryContext.Chunks = append(queryContext.Chunks, ScoredChunk{Chunk: *chunk, Score: chunkScores[chunkIDs[i]]})
+		if len(queryContext.Chunks) == s.Config.TopChunks {
+			break
+		}
+	}
+	return queryContext, nil
+}
+
+// linkEntities maps query entities to graph entities, by name if possible
+// and by embedding similarity otherwise. The returned weights are the
+// similarities of the links.
+func (s *DefaultStateManagerService) linkEntities(ctx context.Context, queryEntities []types.Entity) (map[string]float64, error) {
+	seeds := make(map[string]float64)
+	var unresolved []types.Entity
+	for _, entity := range queryEntities {
+		if _, ok := s.Graph.GetNode(entity.Name); ok {
+			seeds[entity.Name] += 1
+		} else {
+			unresolved = append(unresolved, entity)
+		}
+	}
+	if len(unresolved) == 0 || s.Entities.Size() == 0 {
+		return seeds, nil
+	}
+
+	names := make([]string, len(unresolved))
+	for i, entity := range unresolved {
+		names[i] = entity.Name
+	}
+	embeddings, err := s.Embedder.GetEmbedding(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) != len(names) {
+		return nil, fmt.Errorf("got %d embeddings for %d query entities", len(embeddings), len(names))
+	}
+	for i, entity := range unresolved {
+		topK := 1
+		if entity.Type == GenericQueryEntity {
+			topK = s.Config.EntitiesPerGenericEntity
+		}
+		matches, err := s.Entities.Search(embeddings[i].Vector, topK, s.Config.EntitySimilarityThreshold)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			seeds[match.ID] += float64(match.Score)
+		}
+	}
+	return seeds, nil
+}
+
+// String formats the context as tables of entities and relations followed
+// by the source chunks, as expected by the generate_response_query prompt.
+func (c *QueryContext) String() string {
+	var b strings.Builder
+	b.WriteString("## Entities\n```csv\nname;type;description\n")
+	for _, entity := range c.Entities {
+		fmt.Fprintf(&b, "%s;%s;%s\n", entity.Entity.Name, entity.Entity.Type, oneLine(entity.Entity.Description))
+	}
+	b.WriteString("```\n\n## Relationships\n```csv\nsource;target;description\n")
+	for _, relation := range c.Relations {
+		fmt.Fprintf(&b, "%s;%s;%s\n", relation.Relation.Source, relation.Relation.Target, oneLine(relation.Relation.Description))
+	}
+	b.WriteString("```\n\n## Sources\n")
+	for i, chunk := range c.Chunks {
+		fmt.Fprintf(&b, "\n### Source %d\n%s\n", i+1, chunk.Chunk.Content)
+	}
+	return b.String()
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
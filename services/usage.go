@@ -0,0 +1,28 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// Operations the token usage of the pipeline is attributed to, see llms.WithOperation.
+const (
+	OperationExtraction      = "extraction"
+	OperationGleaning        = "gleaning"
+	OperationSummarization   = "summarization"
+	OperationRelationMerging = "relation_merging"
+	OperationEmbedding       = "embedding"
+	OperationQuery           = "query"
+)
+
+// DocumentLabel names the document made of chunks in usage reports: the
+// "id" metadata of the document if it has one, its index otherwise.
+func DocumentLabel(index int, chunks []types.Chunk) string {
+	if len(chunks) > 0 {
+		if id, ok := chunks[0].Metadata["id"]; ok {
+			return fmt.Sprint(id)
+		}
+	}
+	return fmt.Sprintf("document %d", index)
+}
@@ -1,7 +1,53 @@
 package storage
 
+import (
+	"errors"
+	"io"
+	"iter"
+)
+
+var (
+	// ErrNodeNotFound is returned when an operation references a node that is not stored.
+	ErrNodeNotFound = errors.New("node not found")
+	// ErrInvalidNode is returned when a node cannot be keyed, e.g. it has an empty name.
+	ErrInvalidNode = errors.New("invalid node")
+)
+
 // BaseGraphStorage defines the interface for graph storage.
-type BaseGraphStorage[Node, ID any] interface {
+//
+// Edges are undirected: GetEdges(a, b) and GetEdges(b, a) return the same
+// edges, and several edges may connect the same pair of nodes.
+type BaseGraphStorage[Node, Edge, ID any] interface {
 	InsertStart() error
 	InsertDone() error
+
+	NodeCount() int
+	EdgeCount() int
+
+	// GetNode returns the node stored under id.
+	GetNode(id ID) (Node, bool)
+	// UpsertNode inserts node or replaces the node with the same id.
+	UpsertNode(node Node) error
+	// DeleteNode removes a node together with all of its edges.
+	DeleteNode(id ID) error
+	// Nodes iterates over all nodes ordered by id.
+	Nodes() iter.Seq[Node]
+
+	// GetEdges returns all edges between source and target.
+	GetEdges(source, target ID) []Edge
+	// UpsertEdge inserts edge or replaces the edge between the same
+	// endpoints with the same description. Both endpoints must exist.
+	UpsertEdge(edge Edge) error
+	// DeleteEdges removes all edges between source and target.
+	DeleteEdges(source, target ID) error
+	// Edges iterates over all edges ordered by endpoints.
+	Edges() iter.Seq[Edge]
+
+	// Neighbors iterates over the ids of all nodes adjacent to id.
+	Neighbors(id ID) iter.Seq[ID]
+	// Degree returns the number of edges incident to id.
+	Degree(id ID) int
+
+	Save(w io.Writer) error
+	Load(r io.Reader) error
 }
@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"sync"
+
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// edgeKey identifies the unordered pair of endpoints of an edge.
+type edgeKey struct {
+	a, b string
+}
+
+func newEdgeKey(source, target string) edgeKey {
+	if target < source {
+		source, target = target, source
+	}
+	return edgeKey{a: source, b: target}
+}
+
+// MemoryGraphStorage is an in-memory graph of entities keyed by entity name.
+// It is safe for concurrent use.
+type MemoryGraphStorage struct {
+	mu        sync.RWMutex
+	nodes     map[string]types.Entity
+	edges     map[edgeKey][]types.Relation
+	adjacency map[string]map[string]struct{}
+	edgeCount int
+}
+
+// memoryGraphSnapshot is the persisted form of a MemoryGraphStorage.
+type memoryGraphSnapshot struct {
+	Nodes []types.Entity
+	Edges []types.Relation
+}
+
+var _ BaseGraphStorage[types.Entity, types.Relation, string] = (*MemoryGraphStorage)(nil)
+
+// NewMemoryGraphStorage creates an empty in-memory graph storage.
+func NewMemoryGraphStorage() *MemoryGraphStorage {
+	return &MemoryGraphStorage{
+		nodes:     make(map[string]types.Entity),
+		edges:     make(map[edgeKey][]types.Relation),
+		adjacency: make(map[string]map[string]struct{}),
+	}
+}
+
+// InsertStart prepares the storage for a batch of insertions.
+func (g *MemoryGraphStorage) InsertStart() error {
+	return nil
+}
+
+// InsertDone finalizes a batch of insertions.
+func (g *MemoryGraphStorage) InsertDone() error {
+	return nil
+}
+
+// NodeCount returns the number of stored nodes.
+func (g *MemoryGraphStorage) NodeCount() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.nodes)
+}
+
+// EdgeCount returns the number of stored edges.
+func (g *MemoryGraphStorage) EdgeCount() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.edgeCount
+}
+
+// GetNode returns the entity with the given name.
+func (g *MemoryGraphStorage) GetNode(id string) (types.Entity, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	node, ok := g.nodes[id]
+	return node, ok
+}
+
+// UpsertNode inserts the entity or replaces the entity with the same name.
+func (g *MemoryGraphStorage) UpsertNode(node types.Entity) error {
+	if node.Name == "" {
+		return fmt.Errorf("%w: empty name", ErrInvalidNode)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.nodes[node.Name] = node
+	return nil
+}
+
+// DeleteNode removes the entity with the given name and all its edges.
+func (g *MemoryGraphStorage) DeleteNode(id string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.nodes[id]; !ok {
+		return fmt.Errorf("%w: %q", ErrNodeNotFound, id)
+	}
+	for neighbor := range g.adjacency[id] {
+		g.deleteEdgesLocked(id, neighbor)
+	}
+	delete(g.adjacency, id)
+	delete(g.nodes, id)
+	return nil
+}
+
+// Nodes iterates over a snapshot of all entities ordered by name.
+func (g *MemoryGraphStorage) Nodes() iter.Seq[types.Entity] {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return slices.Values(g.nodesLocked())
+}
+
+// GetEdges returns a copy of all relations between source and target.
+func (g *MemoryGraphStorage) GetEdges(source, target string) []types.Relation {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return cloneRelations(g.edges[newEdgeKey(source, target)])
+}
+
+// UpsertEdge inserts the relation or replaces the relation between the same
+// endpoints with the same description.
+func (g *MemoryGraphStorage) UpsertEdge(edge types.Relation) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, name := range []string{edge.Source, edge.Target} {
+		if _, ok := g.nodes[name]; !ok {
+			return fmt.Errorf("%w: %q", ErrNodeNotFound, name)
+		}
+	}
+	edge.Chunks = slices.Clone(edge.Chunks)
+	key := newEdgeKey(edge.Source, edge.Target)
+	for i, existing := range g.edges[key] {
+		if existing.Description == edge.Description {
+			g.edges[key][i] = edge
+			return nil
+		}
+	}
+	g.edges[key] = append(g.edges[key], edge)
+	g.edgeCount++
+	g.link(edge.Source, edge.Target)
+	g.link(edge.Target, edge.Source)
+	return nil
+}
+
+// DeleteEdges removes all relations between source and target.
+func (g *MemoryGraphStorage) DeleteEdges(source, target string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.deleteEdgesLocked(source, target)
+	return nil
+}
+
+// Edges iterates over a snapshot of all relations ordered by endpoints.
+func (g *MemoryGraphStorage) Edges() iter.Seq[types.Relation] {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return slices.Values(g.edgesLocked())
+}
+
+// Neighbors iterates over a snapshot of the names of all entities adjacent
+// to id, ordered by name.
+func (g *MemoryGraphStorage) Neighbors(id string) iter.Seq[string] {
+	g.mu.RLock()
+	neighbors := make([]string, 0, len(g.adjacency[id]))
+	for neighbor := range g.adjacency[id] {
+		neighbors = append(neighbors, neighbor)
+	}
+	g.mu.RUnlock()
+	slices.Sort(neighbors)
+	return slices.Values(neighbors)
+}
+
+// Degree returns the number of relations incident to id.
+func (g *MemoryGraphStorage) Degree(id string) int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	degree := 0
+	for neighbor := range g.adjacency[id] {
+		degree += len(g.edges[newEdgeKey(id, neighbor)])
+	}
+	return degree
+}
+
+// Save writes all entities and relations to w.
+func (g *MemoryGraphStorage) Save(w io.Writer) error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(memoryGraphSnapshot{
+		Nodes: g.nodesLocked(),
+		Edges: g.edgesLocked(),
+	})
+}
+
+// Load replaces the content of the storage with the graph read from r.
+func (g *MemoryGraphStorage) Load(r io.Reader) error {
+	var snapshot memoryGraphSnapshot
+	if err := gob.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+	loaded := NewMemoryGraphStorage()
+	for _, node := range snapshot.Nodes {
+		if err := loaded.UpsertNode(node); err != nil {
+			return err
+		}
+	}
+	for _, edge := range snapshot.Edges {
+		if err := loaded.UpsertEdge(edge); err != nil {
+			return err
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.nodes, g.edges, g.adjacency, g.edgeCount = loaded.nodes, loaded.edges, loaded.adjacency, loaded.edgeCount
+	return nil
+}
+
+func (g *MemoryGraphStorage) nodesLocked() []types.Entity {
+	names := make([]string, 0, len(g.nodes))
+	for name := range g.nodes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	nodes := make([]types.Entity, len(names))
+	for i, name := range names {
+		nodes[i] = g.nodes[name]
+	}
+	return nodes
+}
+
+func (g *MemoryGraphStorage) edgesLocked() []types.Relation {
+	keys := make([]edgeKey, 0, len(g.edges))
+	for key := range g.edges {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compareEdgeKeys)
+	edges := make([]types.Relation, 0, g.edgeCount)
+	for _, key := range keys {
+		edges = append(edges, cloneRelations(g.edges[key])...)
+	}
+	return edges
+}
+
+func (g *MemoryGraphStorage) link(from, to string) {
+	if g.adjacency[from] == nil {
+		g.adjacency[from] = make(map[string]struct{})
+	}
+	g.adjacency[from][to] = struct{}{}
+}
+
+func (g *MemoryGraphStorage) deleteEdgesLocked(source, target string) {
+	key := newEdgeKey(source, target)
+	g.edgeCount -= len(g.edges[key])
+	delete(g.edges, key)
+	delete(g.adjacency[source], target)
+	delete(g.adjacency[target], source)
+}
+
+func compareEdgeKeys(x, y edgeKey) int {
+	if c := cmp.Compare(x.a, y.a); c != 0 {
+		return c
+	}
+	return cmp.Compare(x.b, y.b)
+}
+
+func cloneRelations(relations []types.Relation) []types.Relation {
+	if relations == nil {
+		return nil
+	}
+	cloned := make([]types.Relation, len(relations))
+	for i, relation := range relations {
+		cloned[i] = relation
+		cloned[i].Chunks = slices.Clone(relation.Chunks)
+	}
+	return cloned
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// newPeopleGraph returns a graph of ALICE, BOB and CAROL, where ALICE trusts
+// and works with BOB, BOB knows CAROL and CAROL writes to herself.
+func newPeopleGraph(t *testing.T) *MemoryGraphStorage {
+	t.Helper()
+	g := NewMemoryGraphStorage()
+	for _, name := range []string{"ALICE", "BOB", "CAROL"} {
+		if err := g.UpsertNode(types.Entity{Name: name, Type: "PERSON"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, edge := range []types.Relation{
+		{Source: "ALICE", Target: "BOB", Description: "trusts", Chunks: []uint64{1}},
+		{Source: "BOB", Target: "ALICE", Description: "works with", Chunks: []uint64{2}},
+		{Source: "BOB", Target: "CAROL", Description: "knows", Chunks: []uint64{3}},
+		{Source: "CAROL", Target: "CAROL", Description: "writes to", Chunks: []uint64{4}},
+	} {
+		if err := g.UpsertEdge(edge); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return g
+}
+
+func descriptions(edges []types.Relation) []string {
+	var descriptions []string
+	for _, edge := range edges {
+		descriptions = append(descriptions, edge.Description)
+	}
+	return descriptions
+}
+
+func TestMemoryGraphStorageNodes(t *testing.T) {
+	g := NewMemoryGraphStorage()
+	if err := g.UpsertNode(types.Entity{Name: "ALICE", Type: "PERSON", Description: "A cryptographer."}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.UpsertNode(types.Entity{Name: "ALICE", Type: "PERSON", Description: "Lives in Paris."}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.UpsertNode(types.Entity{Type: "PERSON"}); !errors.Is(err, ErrInvalidNode) {
+		t.Errorf("got %v, want ErrInvalidNode", err)
+	}
+	if node, ok := g.GetNode("ALICE"); !ok || node.Description != "Lives in Paris." {
+		t.Errorf("got %+v, %v, want the replaced entity", node, ok)
+	}
+	if _, ok := g.GetNode("BOB"); ok {
+		t.Error("got an entity for the unknown BOB")
+	}
+	if g.NodeCount() != 1 {
+		t.Errorf("got %d entities, want 1", g.NodeCount())
+	}
+	if err := g.UpsertEdge(types.Relation{Source: "ALICE", Target: "BOB"}); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("got %v, want ErrNodeNotFound", err)
+	}
+	if err := g.DeleteNode("BOB"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("got %v, want ErrNodeNotFound", err)
+	}
+}
+
+func TestMemoryGraphStorageEdges(t *testing.T) {
+	g := newPeopleGraph(t)
+	if g.EdgeCount() != 4 {
+		t.Errorf("got %d relations, want 4", g.EdgeCount())
+	}
+
+	// The relations are found from both endpoints, and replaced by
+	// description whatever their direction.
+	for _, endpoints := range [][2]string{{"ALICE", "BOB"}, {"BOB", "ALICE"}} {
+		edges := g.GetEdges(endpoints[0], endpoints[1])
+		if got := descriptions(edges); !slices.Equal(got, []string{"trusts", "works with"}) {
+			t.Errorf("%s -> %s: got %v, want trusts and works with", endpoints[0], endpoints[1], got)
+		}
+	}
+	if err := g.UpsertEdge(types.Relation{Source: "BOB", Target: "ALICE", Description: "trusts", Chunks: []uint64{5}}); err != nil {
+		t.Fatal(err)
+	}
+	if edges := g.GetEdges("ALICE", "BOB"); len(edges) != 2 || !slices.Equal(edges[0].Chunks, []uint64{5}) {
+		t.Errorf("got %+v, want trusts replaced", edges)
+	}
+	if g.EdgeCount() != 4 {
+		t.Errorf("got %d relations after a replacement, want 4", g.EdgeCount())
+	}
+
+	// The returned relations are copies.
+	g.GetEdges("ALICE", "BOB")[0].Chunks[0] = 6
+	if edges := g.GetEdges("ALICE", "BOB"); edges[0].Chunks[0] != 5 {
+		t.Error("changing a returned relation changed the storage")
+	}
+
+	if got := slices.Collect(g.Neighbors("BOB")); !slices.Equal(got, []string{"ALICE", "CAROL"}) {
+		t.Errorf("got neighbors %v, want ALICE and CAROL", got)
+	}
+	if got := descriptions(slices.Collect(g.Edges())); !slices.Equal(got, []string{"trusts", "works with", "knows", "writes to"}) {
+		t.Errorf("got relations %v ordered by endpoints", got)
+	}
+
+	if err := g.DeleteEdges("BOB", "ALICE"); err != nil {
+		t.Fatal(err)
+	}
+	if edges := g.GetEdges("ALICE", "BOB"); len(edges) != 0 || g.EdgeCount() != 2 {
+		t.Errorf("got %+v and %d relations after DeleteEdges", edges, g.EdgeCount())
+	}
+	if got := slices.Collect(g.Neighbors("ALICE")); len(got) != 0 {
+		t.Errorf("got neighbors %v of ALICE, want none", got)
+	}
+}
+
+func TestMemoryGraphStorageDegree(t *testing.T) {
+	g := newPeopleGraph(t)
+	// The relation of CAROL to herself is counted once.
+	for name, want := range map[string]int{"ALICE": 2, "BOB": 3, "CAROL": 2, "DAVE": 0} {
+		if got := g.Degree(name); got != want {
+			t.Errorf("%s: got degree %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestMemoryGraphStorageDeleteNode(t *testing.T) {
+	g := newPeopleGraph(t)
+	if err := g.DeleteNode("BOB"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.GetNode("BOB"); ok || g.NodeCount() != 2 {
+		t.Error("BOB is still stored")
+	}
+	if got := descriptions(slices.Collect(g.Edges())); !slices.Equal(got, []string{"writes to"}) || g.EdgeCount() != 1 {
+		t.Errorf("got relations %v, want the relations of BOB dropped", got)
+	}
+	for _, name := range []string{"ALICE", "CAROL"} {
+		if slices.Contains(slices.Collect(g.Neighbors(name)), "BOB") {
+			t.Errorf("BOB is still a neighbor of %s", name)
+		}
+	}
+	if err := g.DeleteNode("CAROL"); err != nil {
+		t.Fatal(err)
+	}
+	if g.EdgeCount() != 0 || g.Degree("CAROL") != 0 {
+		t.Errorf("got %d relations, want the relation of CAROL to herself dropped", g.EdgeCount())
+	}
+}
+
+func TestMemoryGraphStorageSaveLoad(t *testing.T) {
+	g := newPeopleGraph(t)
+	var buf bytes.Buffer
+	if err := g.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMemoryGraphStorage()
+	if err := loaded.UpsertNode(types.Entity{Name: "DAVE"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(slices.Collect(loaded.Nodes()), slices.Collect(g.Nodes())) {
+		t.Errorf("got entities %v, want %v", slices.Collect(loaded.Nodes()), slices.Collect(g.Nodes()))
+	}
+	edges, want := slices.Collect(loaded.Edges()), slices.Collect(g.Edges())
+	if !slices.EqualFunc(edges, want, func(a, b types.Relation) bool {
+		return a.Source == b.Source && a.Target == b.Target && a.Description == b.Description && slices.Equal(a.Chunks, b.Chunks)
+	}) {
+		t.Errorf("got relations %+v, want %+v", edges, want)
+	}
+	if loaded.EdgeCount() != 4 || loaded.Degree("BOB") != 3 {
+		t.Errorf("got %d relations and a degree of %d for BOB, want 4 and 3", loaded.EdgeCount(), loaded.Degree("BOB"))
+	}
+}
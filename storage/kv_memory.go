@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// MemoryKVStorage is an in-memory key-value storage.
+// It is safe for concurrent use.
+type MemoryKVStorage[K cmp.Ordered, V any] struct {
+	mu     sync.RWMutex
+	values map[K]V
+}
+
+// memoryKVSnapshot is the persisted form of a MemoryKVStorage.
+type memoryKVSnapshot[K cmp.Ordered, V any] struct {
+	Keys   []K
+	Values []V
+}
+
+var _ BaseKVStorage[uint64, string] = (*MemoryKVStorage[uint64, string])(nil)
+
+// NewMemoryKVStorage creates an empty in-memory key-value storage.
+func NewMemoryKVStorage[K cmp.Ordered, V any]() *MemoryKVStorage[K, V] {
+	return &MemoryKVStorage[K, V]{values: make(map[K]V)}
+}
+
+// Size returns the number of stored values.
+func (s *MemoryKVStorage[K, V]) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.values)
+}
+
+// Get returns copies of the values stored under keys.
+func (s *MemoryKVStorage[K, V]) Get(keys []K) []*V {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	values := make([]*V, len(keys))
+	for i, key := range keys {
+		if value, ok := s.values[key]; ok {
+			values[i] = &value
+		}
+	}
+	return values
+}
+
+// Upsert inserts the values or replaces the values with the same keys.
+func (s *MemoryKVStorage[K, V]) Upsert(keys []K, values []V) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("got %d keys and %d values", len(keys), len(values))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, key := range keys {
+		s.values[key] = values[i]
+	}
+	return nil
+}
+
+// Delete removes the values with the given keys.
+func (s *MemoryKVStorage[K, V]) Delete(keys []K) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.values, key)
+	}
+	return nil
+}
+
+// Has reports for every key whether a value is stored under it.
+func (s *MemoryKVStorage[K, V]) Has(keys []K) []bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		_, found[i] = s.values[key]
+	}
+	return found
+}
+
+// FilterNew returns the keys which have no value stored under them,
+// preserving their order.
+func (s *MemoryKVStorage[K, V]) FilterNew(keys []K) []K {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var missing []K
+	for _, key := range keys {
+		if _, ok := s.values[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// Save writes all values to w ordered by key.
+func (s *MemoryKVStorage[K, V]) Save(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := memoryKVSnapshot[K, V]{Keys: make([]K, 0, len(s.values))}
+	for key := range s.values {
+		snapshot.Keys = append(snapshot.Keys, key)
+	}
+	slices.Sort(snapshot.Keys)
+	snapshot.Values = make([]V, len(snapshot.Keys))
+	for i, key := range snapshot.Keys {
+		snapshot.Values[i] = s.values[key]
+	}
+	return gob.NewEncoder(w).Encode(snapshot)
+}
+
+// Load replaces the content of the storage with the values read from r.
+func (s *MemoryKVStorage[K, V]) Load(r io.Reader) error {
+	var snapshot memoryKVSnapshot[K, V]
+	if err := gob.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+	if len(snapshot.Keys) != len(snapshot.Values) {
+		return fmt.Errorf("corrupt snapshot: %d keys and %d values", len(snapshot.Keys), len(snapshot.Values))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = make(map[K]V, len(snapshot.Keys))
+	for i, key := range snapshot.Keys {
+		s.values[key] = snapshot.Values[i]
+	}
+	return nil
+}
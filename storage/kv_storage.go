@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+func init() {
+	// Chunk and document metadata are free-form maps which gob can only
+	// encode when the concrete types of their values are registered.
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(map[string]string{})
+	gob.Register(map[string]int{})
+	gob.Register(map[string]float64{})
+	gob.Register([]string{})
+	gob.Register([]int{})
+	gob.Register([]float64{})
+}
+
+// BaseKVStorage defines the interface for key-value storage.
+type BaseKVStorage[K, V any] interface {
+	Size() int
+	// Get returns the values stored under keys, with nil for missing keys.
+	Get(keys []K) []*V
+	// Upsert inserts the values or replaces the values with the same keys.
+	Upsert(keys []K, values []V) error
+	// Delete removes the values with the given keys, unknown keys are ignored.
+	Delete(keys []K) error
+	// Has reports for every key whether a value is stored under it.
+	Has(keys []K) []bool
+	// FilterNew returns the keys which have no value stored under them.
+	FilterNew(keys []K) []K
+
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// ChunkStorage stores chunks by their xxhash64 ID.
+type ChunkStorage = BaseKVStorage[uint64, types.Chunk]
+
+// NewChunkStorage creates an empty in-memory chunk storage.
+func NewChunkStorage() *MemoryKVStorage[uint64, types.Chunk] {
+	return NewMemoryKVStorage[uint64, types.Chunk]()
+}
+
+// UpsertChunks stores chunks under their ID. It fails without storing any
+// chunk if the metadata of one cannot be saved, see CheckChunks.
+func UpsertChunks(kv ChunkStorage, chunks []types.Chunk) error {
+	if err := CheckChunks(chunks); err != nil {
+		return err
+	}
+	ids := make([]uint64, len(chunks))
+	for i, chunk := range chunks {
+		ids[i] = chunk.ID
+	}
+	return kv.Upsert(ids, chunks)
+}
+
+// CheckChunks reports an error if the metadata of a chunk holds values gob
+// cannot encode, such as types which are not registered with gob.Register.
+// Such chunks would be stored but fail to be saved.
+func CheckChunks(chunks []types.Chunk) error {
+	for _, chunk := range chunks {
+		if err := gob.NewEncoder(io.Discard).Encode(chunk.Metadata); err != nil {
+			return fmt.Errorf("metadata of chunk %d cannot be saved: %w", chunk.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"slices"
+	"testing"
+
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+func TestMemoryKVStorage(t *testing.T) {
+	s := NewMemoryKVStorage[string, int]()
+	if err := s.Upsert([]string{"a", "b"}, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert([]string{"b", "c"}, []int{3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert([]string{"d"}, nil); err == nil {
+		t.Error("got no error for more keys than values")
+	}
+	if s.Size() != 3 {
+		t.Errorf("got size %d, want 3", s.Size())
+	}
+
+	values := s.Get([]string{"a", "b", "x"})
+	if *values[0] != 1 || *values[1] != 3 || values[2] != nil {
+		t.Errorf("got values %v, want 1, the replaced 3 and nil", values)
+	}
+	if has := s.Has([]string{"c", "x"}); !slices.Equal(has, []bool{true, false}) {
+		t.Errorf("got %v, want [true false]", has)
+	}
+	if missing := s.FilterNew([]string{"x", "a", "y"}); !slices.Equal(missing, []string{"x", "y"}) {
+		t.Errorf("got %v, want [x y]", missing)
+	}
+
+	if err := s.Delete([]string{"a", "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != 2 || s.Get([]string{"a"})[0] != nil {
+		t.Errorf("a is still stored after Delete")
+	}
+}
+
+func TestMemoryKVStorageSaveLoad(t *testing.T) {
+	s := NewChunkStorage()
+	chunks := []types.Chunk{
+		{ID: 2, Content: "Bob founded the Lab.", Metadata: map[string]any{"authors": []string{"Alice"}}},
+		{ID: 1, Content: "Alice works with Bob."},
+	}
+	if err := UpsertChunks(s, chunks); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := s.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewChunkStorage()
+	if err := loaded.Upsert([]uint64{3}, []types.Chunk{{ID: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Size() != 2 {
+		t.Fatalf("got size %d, want the 2 saved chunks", loaded.Size())
+	}
+	for i, chunk := range loaded.Get([]uint64{2, 1}) {
+		if chunk == nil || chunk.Content != chunks[i].Content {
+			t.Errorf("got chunk %+v, want %+v", chunk, chunks[i])
+		}
+	}
+	if authors, _ := (*loaded.Get([]uint64{2})[0]).Metadata["authors"].([]string); !slices.Equal(authors, []string{"Alice"}) {
+		t.Errorf("got authors %v, want [Alice]", authors)
+	}
+}
+
+func TestMemoryKVStorageLoadCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	snapshot := memoryKVSnapshot[string, int]{Keys: []string{"a", "b"}, Values: []int{1}}
+	if err := gob.NewEncoder(&buf).Encode(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemoryKVStorage[string, int]()
+	if err := s.Load(&buf); err == nil {
+		t.Error("got no error for 2 keys and 1 value")
+	}
+	if s.Size() != 0 {
+		t.Errorf("got size %d after a failed Load", s.Size())
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"math"
+	"testing"
+
+	"github.com/binarycraft007/fast-graphrag-go/types"
+)
+
+// newTestGraph builds a graph of the given edges, creating their endpoints.
+func newTestGraph(t *testing.T, edges ...[2]string) *MemoryGraphStorage {
+	t.Helper()
+	graph := NewMemoryGraphStorage()
+	for _, edge := range edges {
+		for _, name := range edge {
+			if err := graph.UpsertNode(types.Entity{Name: name}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := graph.UpsertEdge(types.Relation{Source: edge[0], Target: edge[1]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return graph
+}
+
+func TestPersonalizedPageRank(t *testing.T) {
+	// A chain a - b - c - d and an island e - f.
+	graph := newTestGraph(t, [2]string{"a", "b"}, [2]string{"b", "c"}, [2]string{"c", "d"}, [2]string{"e", "f"})
+
+	entities, relations, err := PersonalizedPageRank(graph, map[string]float64{"a": 1}, DefaultPageRankConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scores := make(map[string]float64)
+	total := 0.0
+	for _, entity := range entities {
+		scores[entity.Entity.Name] = entity.Score
+		total += entity.Score
+	}
+	if math.Abs(total-1) > 1e-4 {
+		t.Errorf("scores sum to %v, want 1", total)
+	}
+	if _, ok := scores["e"]; ok {
+		t.Errorf("entity e is not reachable from the seed but scored %v", scores["e"])
+	}
+	if !(scores["a"] > scores["c"] && scores["c"] > scores["d"] && scores["b"] > scores["d"]) {
+		t.Errorf("scores do not decrease away from the seed: %v", scores)
+	}
+	for i := 1; i < len(entities); i++ {
+		if entities[i].Score > entities[i-1].Score {
+			t.Errorf("entities not sorted by descending score: %v", entities)
+		}
+	}
+
+	if len(relations) != 3 {
+		t.Fatalf("got %d relations, want the 3 relations of the chain", len(relations))
+	}
+	if relations[0].Relation.Source != "a" || relations[0].Relation.Target != "b" {
+		t.Errorf("best relation is %v, want a - b", relations[0].Relation)
+	}
+	for _, relation := range relations {
+		want := scores[relation.Relation.Source] + scores[relation.Relation.Target]
+		if math.Abs(relation.Score-want) > 1e-12 {
+			t.Errorf("relation %v scored %v, want %v", relation.Relation, relation.Score, want)
+		}
+	}
+}
+
+func TestPersonalizedPageRankSeeds(t *testing.T) {
+	graph := newTestGraph(t, [2]string{"a", "b"})
+
+	entities, relations, err := PersonalizedPageRank(graph, map[string]float64{"unknown": 1}, DefaultPageRankConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entities != nil || relations != nil {
+		t.Errorf("got %v and %v for seeds outside the graph, want nothing", entities, relations)
+	}
+
+	for _, weight := range []float64{-1, math.NaN(), math.Inf(1)} {
+		if _, _, err := PersonalizedPageRank(graph, map[string]float64{"a": weight}, DefaultPageRankConfig()); err == nil {
+			t.Errorf("seed weight %v: got no error", weight)
+		}
+	}
+}
+
+func TestPersonalizedPageRankConfig(t *testing.T) {
+	graph := newTestGraph(t, [2]string{"a", "b"})
+	seeds := map[string]float64{"a": 1}
+	for _, config := range []PageRankConfig{
+		{Damping: 1, MaxIterations: 10},
+		{Damping: -0.1, MaxIterations: 10},
+		{Damping: 0.85, MaxIterations: 0},
+	} {
+		if _, _, err := PersonalizedPageRank(graph, seeds, config); err == nil {
+			t.Errorf("config %+v: got no error", config)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"cmp"
+	"container/heap"
+	"encoding/gob"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+// HNSWConfig configures the hierarchical navigable small world graph of an
+// HNSWVectorStorage.
+type HNSWConfig struct {
+	// M is the number of neighbors per node on the upper layers; the bottom
+	// layer keeps twice as many.
+	M int
+	// EfConstruction is the size of the candidate list while inserting.
+	EfConstruction int
+	// EfSearch is the minimum size of the candidate list while searching.
+	EfSearch int
+	// Seed makes the layer assignment reproducible.
+	Seed int64
+}
+
+// DefaultHNSWConfig returns the default HNSW configuration.
+func DefaultHNSWConfig() HNSWConfig {
+	return HNSWConfig{
+		M:              16,
+		EfConstruction: 200,
+		EfSearch:       64,
+		Seed:           1,
+	}
+}
+
+// hnswNode is a vector in the HNSW graph. Deleted nodes are kept to preserve
+// the connectivity of the graph until it is rebuilt.
+type hnswNode[ID cmp.Ordered] struct {
+	ID      ID
+	Vector  []float32
+	Friends [][]int
+	Deleted bool
+}
+
+// hnswSnapshot is the persisted form of an HNSWVectorStorage.
+type hnswSnapshot[ID cmp.Ordered] struct {
+	Dimension  int
+	Config     HNSWConfig
+	Nodes      []hnswNode[ID]
+	EntryPoint int
+	MaxLevel   int
+}
+
+// HNSWVectorStorage is an in-memory vector storage with approximate cosine
+// search over a hierarchical navigable small world graph. It is suited for
+// large collections where exact search becomes too slow.
+// It is safe for concurrent use.
+type HNSWVectorStorage[ID cmp.Ordered] struct {
+	mu         sync.RWMutex
+	config     HNSWConfig
+	dimension  int
+	nodes      []hnswNode[ID]
+	index      map[ID]int
+	entryPoint int
+	maxLevel   int
+	deleted    int
+	rng        *rand.Rand
+}
+
+var _ BaseVectorStorage[string] = (*HNSWVectorStorage[string])(nil)
+
+// NewHNSWVectorStorage creates an empty approximate vector storage. A
+// dimension of 0 is inferred from the first upserted vector, zero config
+// fields fall back to DefaultHNSWConfig.
+func NewHNSWVectorStorage[ID cmp.Ordered](dimension int, config HNSWConfig) *HNSWVectorStorage[ID] {
+	defaults := DefaultHNSWConfig()
+	if config.M <= 0 {
+		config.M = defaults.M
+	}
+	if config.EfConstruction <= 0 {
+		config.EfConstruction = defaults.EfConstruction
+	}
+	if config.EfSearch <= 0 {
+		config.EfSearch = defaults.EfSearch
+	}
+	return &HNSWVectorStorage[ID]{
+		config:     config,
+		dimension:  dimension,
+		index:      make(map[ID]int),
+		entryPoint: -1,
+		rng:        rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// Size returns the number of stored vectors.
+func (h *HNSWVectorStorage[ID]) Size() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.index)
+}
+
+// Get returns the normalized vector stored under id.
+func (h *HNSWVectorStorage[ID]) Get(id ID) ([]float32, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	i, ok := h.index[id]
+	if !ok {
+		return nil, false
+	}
+	return slices.Clone(h.nodes[i].Vector), true
+}
+
+// Upsert inserts the vectors or replaces the vectors with the same ids.
+func (h *HNSWVectorStorage[ID]) Upsert(ids []ID, vectors [][]float32) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// The first vectors set the dimension, once they are all valid.
+	dimension := h.dimension
+	if dimension == 0 && len(vectors) > 0 {
+		dimension = len(vectors[0])
+	}
+	normalized, err := checkVectors(dimension, ids, vectors)
+	if err != nil {
+		return err
+	}
+	h.dimension = dimension
+	for i, id := range ids {
+		h.remove(id)
+		h.insert(id, normalized[i])
+	}
+	h.compact()
+	return nil
+}
+
+// Delete removes the vectors with the given ids.
+func (h *HNSWVectorStorage[ID]) Delete(ids []ID) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, id := range ids {
+		h.remove(id)
+	}
+	h.compact()
+	return nil
+}
+
+// Search returns the approximate nearest neighbors of query.
+func (h *HNSWVectorStorage[ID]) Search(query []float32, topK int, threshold float32) ([]VectorMatch[ID], error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.index) == 0 {
+		return nil, nil
+	}
+	query, err := checkVector(h.dimension, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleted nodes are dropped from the candidates, so the list is widened
+	// by their number to still hold topK live ones.
+	ef := max(h.config.EfSearch, topK) + h.deleted
+	if topK <= 0 {
+		ef = len(h.nodes)
+	}
+	entryPoint := h.entryPoint
+	for level := h.maxLevel; level > 0; level-- {
+		entryPoint = h.greedySearch(query, entryPoint, level)
+	}
+
+	var matches []VectorMatch[ID]
+	for _, c := range h.searchLayer(query, entryPoint, ef, 0) {
+		node := h.nodes[c.node]
+		if score := 1 - c.distance; !node.Deleted && score >= threshold {
+			matches = append(matches, VectorMatch[ID]{ID: node.ID, Score: score})
+		}
+	}
+	return sortMatches(matches, topK), nil
+}
+
+// Save writes the HNSW graph to w.
+func (h *HNSWVectorStorage[ID]) Save(w io.Writer) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(hnswSnapshot[ID]{
+		Dimension:  h.dimension,
+		Config:     h.config,
+		Nodes:      h.nodes,
+		EntryPoint: h.entryPoint,
+		MaxLevel:   h.maxLevel,
+	})
+}
+
+// Load replaces the content of the storage with the HNSW graph read from r.
+func (h *HNSWVectorStorage[ID]) Load(r io.Reader) error {
+	var snapshot hnswSnapshot[ID]
+	if err := gob.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dimension = snapshot.Dimension
+	h.config = snapshot.Config
+	h.nodes = snapshot.Nodes
+	h.entryPoint = snapshot.EntryPoint
+	h.maxLevel = snapshot.MaxLevel
+	h.rng = rand.New(rand.NewSource(h.config.Seed))
+	h.index = make(map[ID]int, len(h.nodes))
+	h.deleted = 0
+	for i, node := range h.nodes {
+		if node.Deleted {
+			h.deleted++
+		} else {
+			h.index[node.ID] = i
+		}
+	}
+	return nil
+}
+
+func (h *HNSWVectorStorage[ID]) maxFriends(level int) int {
+	if level == 0 {
+		return 2 * h.config.M
+	}
+	return h.config.M
+}
+
+func (h *HNSWVectorStorage[ID]) randomLevel() int {
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) / math.Log(float64(max(h.config.M, 2)))))
+}
+
+func (h *HNSWVectorStorage[ID]) distance(query []float32, node int) float32 {
+	return 1 - dot(query, h.nodes[node].Vector)
+}
+
+func (h *HNSWVectorStorage[ID]) insert(id ID, vector []float32) {
+	level := h.randomLevel()
+	n := len(h.nodes)
+	h.nodes = append(h.nodes, hnswNode[ID]{ID: id, Vector: vector, Friends: make([][]int, level+1)})
+	h.index[id] = n
+	if h.entryPoint < 0 {
+		h.entryPoint, h.maxLevel = n, level
+		return
+	}
+
+	entryPoint := h.entryPoint
+	for l := h.maxLevel; l > level; l-- {
+		entryPoint = h.greedySearch(vector, entryPoint, l)
+	}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(vector, entryPoint, h.config.EfConstruction, l)
+		friends := make([]int, 0, h.maxFriends(l))
+		for _, c := range candidates[:min(len(candidates), h.maxFriends(l))] {
+			friends = append(friends, c.node)
+		}
+		h.nodes[n].Friends[l] = friends
+		for _, friend := range friends {
+			h.nodes[friend].Friends[l] = append(h.nodes[friend].Friends[l], n)
+			h.pruneFriends(friend, l)
+		}
+		entryPoint = candidates[0].node
+	}
+	if level > h.maxLevel {
+		h.entryPoint, h.maxLevel = n, level
+	}
+}
+
+// pruneFriends keeps only the closest neighbors of node on level.
+func (h *HNSWVectorStorage[ID]) pruneFriends(node, level int) {
+	friends := h.nodes[node].Friends[level]
+	if len(friends) <= h.maxFriends(level) {
+		return
+	}
+	vector := h.nodes[node].Vector
+	slices.SortStableFunc(friends, func(a, b int) int {
+		return cmp.Compare(h.distance(vector, a), h.distance(vector, b))
+	})
+	h.nodes[node].Friends[level] = friends[:h.maxFriends(level)]
+}
+
+// greedySearch walks level towards the node closest to query.
+func (h *HNSWVectorStorage[ID]) greedySearch(query []float32, entryPoint, level int) int {
+	best, bestDistance := entryPoint, h.distance(query, entryPoint)
+	for changed := true; changed; {
+		changed = false
+		for _, friend := range h.nodes[best].Friends[level] {
+			if d := h.distance(query, friend); d < bestDistance {
+				best, bestDistance, changed = friend, d, true
+			}
+		}
+	}
+	return best
+}
+
+// searchLayer returns up to ef nodes of level closest to query, sorted by
+// ascending distance.
+func (h *HNSWVectorStorage[ID]) searchLayer(query []float32, entryPoint, ef, level int) []hnswCandidate {
+	visited := map[int]bool{entryPoint: true}
+	start := hnswCandidate{node: entryPoint, distance: h.distance(query, entryPoint)}
+	candidates := &hnswCandidates{start}
+	results := []hnswCandidate{start}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if len(results) >= ef && current.distance > results[len(results)-1].distance {
+			break
+		}
+		for _, friend := range h.nodes[current.node].Friends[level] {
+			if visited[friend] {
+				continue
+			}
+			visited[friend] = true
+			c := hnswCandidate{node: friend, distance: h.distance(query, friend)}
+			if len(results) >= ef && c.distance >= results[len(results)-1].distance {
+				continue
+			}
+			heap.Push(candidates, c)
+			i, _ := slices.BinarySearchFunc(results, c, func(a, b hnswCandidate) int {
+				return cmp.Compare(a.distance, b.distance)
+			})
+			results = slices.Insert(results, i, c)
+			if len(results) > ef {
+				results = results[:ef]
+			}
+		}
+	}
+	return results
+}
+
+func (h *HNSWVectorStorage[ID]) remove(id ID) {
+	if i, ok := h.index[id]; ok {
+		h.nodes[i].Deleted = true
+		h.deleted++
+		delete(h.index, id)
+	}
+}
+
+// compact rebuilds the graph once deleted nodes outnumber the live ones.
+func (h *HNSWVectorStorage[ID]) compact() {
+	if h.deleted <= len(h.index) {
+		return
+	}
+	nodes := h.nodes
+	h.nodes = nil
+	h.index = make(map[ID]int, len(h.index))
+	h.entryPoint, h.maxLevel, h.deleted = -1, 0, 0
+	for _, node := range nodes {
+		if !node.Deleted {
+			h.insert(node.ID, node.Vector)
+		}
+	}
+}
+
+// hnswCandidate is a node and its distance to the query.
+type hnswCandidate struct {
+	node     int
+	distance float32
+}
+
+// hnswCandidates is a min-heap of candidates ordered by distance.
+type hnswCandidates []hnswCandidate
+
+func (c hnswCandidates) Len() int           { return len(c) }
+func (c hnswCandidates) Less(i, j int) bool { return c[i].distance < c[j].distance }
+func (c hnswCandidates) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c *hnswCandidates) Push(x any)        { *c = append(*c, x.(hnswCandidate)) }
+func (c *hnswCandidates) Pop() any {
+	old := *c
+	x := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// MemoryVectorStorage is an in-memory vector storage with exact cosine search.
+// It is safe for concurrent use.
+type MemoryVectorStorage[ID cmp.Ordered] struct {
+	mu        sync.RWMutex
+	dimension int
+	ids       []ID
+	vectors   [][]float32
+	index     map[ID]int
+}
+
+var _ BaseVectorStorage[string] = (*MemoryVectorStorage[string])(nil)
+
+// memoryVectorSnapshot is the persisted form of a MemoryVectorStorage.
+type memoryVectorSnapshot[ID cmp.Ordered] struct {
+	Dimension int
+	IDs       []ID
+	Vectors   [][]float32
+}
+
+// NewMemoryVectorStorage creates an empty exact vector storage. A dimension
+// of 0 is inferred from the first upserted vector.
+func NewMemoryVectorStorage[ID cmp.Ordered](dimension int) *MemoryVectorStorage[ID] {
+	return &MemoryVectorStorage[ID]{
+		dimension: dimension,
+		index:     make(map[ID]int),
+	}
+}
+
+// Size returns the number of stored vectors.
+func (s *MemoryVectorStorage[ID]) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.ids)
+}
+
+// Get returns the normalized vector stored under id.
+func (s *MemoryVectorStorage[ID]) Get(id ID) ([]float32, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.index[id]
+	if !ok {
+		return nil, false
+	}
+	return slices.Clone(s.vectors[i]), true
+}
+
+// Upsert inserts the vectors or replaces the vectors with the same ids.
+func (s *MemoryVectorStorage[ID]) Upsert(ids []ID, vectors [][]float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The first vectors set the dimension, once they are all valid.
+	dimension := s.dimension
+	if dimension == 0 && len(vectors) > 0 {
+		dimension = len(vectors[0])
+	}
+	normalized, err := checkVectors(dimension, ids, vectors)
+	if err != nil {
+		return err
+	}
+	s.dimension = dimension
+	for i, id := range ids {
+		if j, ok := s.index[id]; ok {
+			s.vectors[j] = normalized[i]
+			continue
+		}
+		s.index[id] = len(s.ids)
+		s.ids = append(s.ids, id)
+		s.vectors = append(s.vectors, normalized[i])
+	}
+	return nil
+}
+
+// Delete removes the vectors with the given ids.
+func (s *MemoryVectorStorage[ID]) Delete(ids []ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		i, ok := s.index[id]
+		if !ok {
+			continue
+		}
+		last := len(s.ids) - 1
+		s.ids[i], s.vectors[i] = s.ids[last], s.vectors[last]
+		s.index[s.ids[i]] = i
+		s.ids, s.vectors = s.ids[:last], s.vectors[:last]
+		delete(s.index, id)
+	}
+	return nil
+}
+
+// Search compares query against every stored vector.
+func (s *MemoryVectorStorage[ID]) Search(query []float32, topK int, threshold float32) ([]VectorMatch[ID], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.ids) == 0 {
+		return nil, nil
+	}
+	query, err := checkVector(s.dimension, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []VectorMatch[ID]
+	for i, vector := range s.vectors {
+		if score := dot(query, vector); score >= threshold {
+			matches = append(matches, VectorMatch[ID]{ID: s.ids[i], Score: score})
+		}
+	}
+	return sortMatches(matches, topK), nil
+}
+
+// Save writes all vectors to w.
+func (s *MemoryVectorStorage[ID]) Save(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(memoryVectorSnapshot[ID]{
+		Dimension: s.dimension,
+		IDs:       s.ids,
+		Vectors:   s.vectors,
+	})
+}
+
+// Load replaces the content of the storage with the vectors read from r.
+func (s *MemoryVectorStorage[ID]) Load(r io.Reader) error {
+	var snapshot memoryVectorSnapshot[ID]
+	if err := gob.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+	if len(snapshot.IDs) != len(snapshot.Vectors) {
+		return fmt.Errorf("corrupt snapshot: %d ids and %d vectors", len(snapshot.IDs), len(snapshot.Vectors))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dimension = snapshot.Dimension
+	s.ids = snapshot.IDs
+	s.vectors = snapshot.Vectors
+	s.index = make(map[ID]int, len(s.ids))
+	for i, id := range s.ids {
+		s.index[id] = i
+	}
+	return nil
+}
+
+// sortMatches sorts matches by descending score, breaking ties by id, and
+// keeps the first topK of them.
+func sortMatches[ID cmp.Ordered](matches []VectorMatch[ID], topK int) []VectorMatch[ID] {
+	slices.SortFunc(matches, func(a, b VectorMatch[ID]) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if topK > 0 && len(matches) > topK {
+		matches = matches[:topK]
+	}
+	return matches
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// vectorStorages returns an empty storage of every implementation.
+func vectorStorages() map[string]func() BaseVectorStorage[string] {
+	return map[string]func() BaseVectorStorage[string]{
+		"memory": func() BaseVectorStorage[string] { return NewMemoryVectorStorage[string](0) },
+		"hnsw":   func() BaseVectorStorage[string] { return NewHNSWVectorStorage[string](0, HNSWConfig{}) },
+	}
+}
+
+func TestVectorStorageSearch(t *testing.T) {
+	for name, newStorage := range vectorStorages() {
+		t.Run(name, func(t *testing.T) {
+			s := newStorage()
+			ids := []string{"x", "y", "xy", "-x"}
+			vectors := [][]float32{{1, 0}, {0, 2}, {1, 1}, {-3, 0}}
+			if err := s.Upsert(ids, vectors); err != nil {
+				t.Fatal(err)
+			}
+
+			matches, err := s.Search([]float32{2, 0}, 2, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(matches) != 2 || matches[0].ID != "x" || matches[1].ID != "xy" {
+				t.Fatalf("got %v, want x then xy", matches)
+			}
+			if matches[0].Score < 0.999 {
+				t.Errorf("score of an identical direction is %v, want 1", matches[0].Score)
+			}
+
+			matches, err = s.Search([]float32{1, 0}, 0, 0.5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(matches) != 2 {
+				t.Errorf("got %v above the threshold, want x and xy", matches)
+			}
+
+			if err := s.Delete([]string{"x", "unknown"}); err != nil {
+				t.Fatal(err)
+			}
+			matches, err = s.Search([]float32{1, 0}, 1, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(matches) != 1 || matches[0].ID != "xy" {
+				t.Errorf("got %v after deleting x, want xy", matches)
+			}
+			if s.Size() != 3 {
+				t.Errorf("size is %d, want 3", s.Size())
+			}
+		})
+	}
+}
+
+func TestVectorStorageUpsertReplaces(t *testing.T) {
+	for name, newStorage := range vectorStorages() {
+		t.Run(name, func(t *testing.T) {
+			s := newStorage()
+			if err := s.Upsert([]string{"a"}, [][]float32{{1, 0}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Upsert([]string{"a"}, [][]float32{{0, 5}}); err != nil {
+				t.Fatal(err)
+			}
+			vector, ok := s.Get("a")
+			if !ok || vector[0] != 0 || vector[1] != 1 {
+				t.Errorf("got %v, want the replaced vector normalized", vector)
+			}
+			if s.Size() != 1 {
+				t.Errorf("size is %d, want 1", s.Size())
+			}
+		})
+	}
+}
+
+func TestVectorStorageDimension(t *testing.T) {
+	for name, newStorage := range vectorStorages() {
+		t.Run(name, func(t *testing.T) {
+			s := newStorage()
+			// A rejected first upsert must not set the dimension.
+			err := s.Upsert([]string{"a", "b"}, [][]float32{{1, 0, 0}, {1, 0}})
+			if !errors.Is(err, ErrDimensionMismatch) {
+				t.Fatalf("got %v, want ErrDimensionMismatch", err)
+			}
+			if err := s.Upsert([]string{"a"}, [][]float32{{0, 0}}); !errors.Is(err, ErrZeroVector) {
+				t.Fatalf("got %v, want ErrZeroVector", err)
+			}
+			if err := s.Upsert([]string{"a"}, [][]float32{{1, 0}}); err != nil {
+				t.Fatalf("upsert after rejected ones: %v", err)
+			}
+			if err := s.Upsert([]string{"b"}, [][]float32{{1, 0, 0}}); !errors.Is(err, ErrDimensionMismatch) {
+				t.Errorf("got %v, want ErrDimensionMismatch", err)
+			}
+			if _, err := s.Search([]float32{1, 0, 0}, 1, 0); !errors.Is(err, ErrDimensionMismatch) {
+				t.Errorf("search: got %v, want ErrDimensionMismatch", err)
+			}
+		})
+	}
+}
+
+func TestVectorStorageSaveLoad(t *testing.T) {
+	for name, newStorage := range vectorStorages() {
+		t.Run(name, func(t *testing.T) {
+			s := newStorage()
+			if err := s.Upsert([]string{"a", "b"}, [][]float32{{1, 0}, {0, 1}}); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := s.Save(&buf); err != nil {
+				t.Fatal(err)
+			}
+			loaded := newStorage()
+			if err := loaded.Load(&buf); err != nil {
+				t.Fatal(err)
+			}
+			matches, err := loaded.Search([]float32{0, 1}, 1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Size() != 2 || len(matches) != 1 || matches[0].ID != "b" {
+				t.Errorf("got %d vectors and %v, want 2 and b", loaded.Size(), matches)
+			}
+		})
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const (
+		count     = 2000
+		dimension = 32
+		queries   = 50
+		topK      = 10
+	)
+	rng := rand.New(rand.NewSource(1))
+	randomVector := func() []float32 {
+		vector := make([]float32, dimension)
+		for i := range vector {
+			vector[i] = float32(rng.NormFloat64())
+		}
+		return vector
+	}
+
+	exact := NewMemoryVectorStorage[string](dimension)
+	approximate := NewHNSWVectorStorage[string](dimension, HNSWConfig{})
+	ids := make([]string, count)
+	vectors := make([][]float32, count)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+		vectors[i] = randomVector()
+	}
+	for _, s := range []BaseVectorStorage[string]{exact, approximate} {
+		if err := s.Upsert(ids, vectors); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found := 0
+	for range queries {
+		query := randomVector()
+		want, err := exact.Search(query, topK, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := approximate.Search(query, topK, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wanted := make(map[string]bool)
+		for _, match := range want {
+			wanted[match.ID] = true
+		}
+		for _, match := range got {
+			if wanted[match.ID] {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / (queries * topK); recall < 0.9 {
+		t.Errorf("recall@%d is %.2f, want at least 0.9", topK, recall)
+	}
+}
+
+func TestHNSWSearchAfterDelete(t *testing.T) {
+	s := NewHNSWVectorStorage[string](2, HNSWConfig{EfSearch: 2})
+	var ids []string
+	var vectors [][]float32
+	for i := range 10 {
+		ids = append(ids, fmt.Sprint(i))
+		vectors = append(vectors, []float32{1, float32(i) / 10})
+	}
+	if err := s.Upsert(ids, vectors); err != nil {
+		t.Fatal(err)
+	}
+	// The nearest vectors are deleted, but not enough of them to rebuild the
+	// graph.
+	if err := s.Delete(ids[:5]); err != nil {
+		t.Fatal(err)
+	}
+	matches, err := s.Search([]float32{1, 0}, 5, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, match := range matches {
+		got = append(got, match.ID)
+	}
+	if !slices.Equal(got, ids[5:]) {
+		t.Errorf("got %v, want the %d live vectors", got, len(ids[5:]))
+	}
+}
+
+func TestMemoryVectorStorageLoadCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	snapshot := memoryVectorSnapshot[string]{Dimension: 2, IDs: []string{"a", "b"}, Vectors: [][]float32{{1, 0}}}
+	if err := gob.NewEncoder(&buf).Encode(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemoryVectorStorage[string](0)
+	if err := s.Load(&buf); err == nil {
+		t.Error("got no error for 2 ids and 1 vector")
+	}
+	if s.Size() != 0 {
+		t.Errorf("got size %d after a failed Load", s.Size())
+	}
+}
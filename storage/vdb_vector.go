@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	// ErrDimensionMismatch is returned when a vector does not have the dimension of the storage.
+	ErrDimensionMismatch = errors.New("vector dimension mismatch")
+	// ErrZeroVector is returned for vectors without a direction, which cannot be compared by cosine.
+	ErrZeroVector = errors.New("zero vector")
+)
+
+// VectorMatch is a single result of a vector search.
+type VectorMatch[ID any] struct {
+	ID    ID
+	Score float32
+}
+
+// BaseVectorStorage defines the interface for vector storage.
+// Vectors are compared by cosine similarity.
+type BaseVectorStorage[ID any] interface {
+	Size() int
+	// Get returns the normalized vector stored under id.
+	Get(id ID) ([]float32, bool)
+	// Upsert inserts the vectors or replaces the vectors with the same ids.
+	Upsert(ids []ID, vectors [][]float32) error
+	// Delete removes the vectors with the given ids, unknown ids are ignored.
+	Delete(ids []ID) error
+	// Search returns the topK most similar vectors with a score of at least
+	// threshold, sorted by descending score. A topK <= 0 returns all matches.
+	Search(query []float32, topK int, threshold float32) ([]VectorMatch[ID], error)
+
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// checkVectors validates the vectors of an upsert and returns their normalized copies.
+func checkVectors[ID any](dimension int, ids []ID, vectors [][]float32) ([][]float32, error) {
+	if len(ids) != len(vectors) {
+		return nil, fmt.Errorf("got %d ids and %d vectors", len(ids), len(vectors))
+	}
+	normalized := make([][]float32, len(vectors))
+	for i, vector := range vectors {
+		v, err := checkVector(dimension, vector)
+		if err != nil {
+			return nil, err
+		}
+		normalized[i] = v
+	}
+	return normalized, nil
+}
+
+// checkVector validates the dimension of vector and returns its normalized copy.
+func checkVector(dimension int, vector []float32) ([]float32, error) {
+	if len(vector) != dimension {
+		return nil, fmt.Errorf("%w: expected %d, got %d", ErrDimensionMismatch, dimension, len(vector))
+	}
+	return normalize(vector)
+}
+
+// normalize returns a copy of vector scaled to unit length.
+func normalize(vector []float32) ([]float32, error) {
+	var norm float64
+	for _, x := range vector {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return nil, ErrZeroVector
+	}
+	norm = math.Sqrt(norm)
+	normalized := make([]float32, len(vector))
+	for i, x := range vector {
+		normalized[i] = float32(float64(x) / norm)
+	}
+	return normalized, nil
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FormatVersion is the version of the files written to a working directory.
+const FormatVersion = 1
+
+// fileMagic starts every storage file of a working directory.
+var fileMagic = [4]byte{'F', 'G', 'R', 'G'}
+
+var (
+	// ErrInvalidFile is returned when a storage file does not start with the expected header.
+	ErrInvalidFile = errors.New("not a storage file")
+	// ErrUnsupportedVersion is returned for files written by a newer format version.
+	ErrUnsupportedVersion = errors.New("unsupported storage format version")
+)
+
+// Persistable is a storage which can be written to and read from a stream.
+type Persistable interface {
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// WorkingDirMetadata describes the content of a working directory.
+type WorkingDirMetadata struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Nodes         int       `json:"nodes"`
+	Edges         int       `json:"edges"`
+	Entities      int       `json:"entities"`
+	Chunks        int       `json:"chunks"`
+}
+
+// WorkingDir persists storages as files of a directory. Every file is
+// written to a temporary file first and renamed over the previous version,
+// so a crash while saving leaves the previous version intact.
+type WorkingDir struct {
+	Path string
+}
+
+// NewWorkingDir creates the directory at path if it does not exist.
+func NewWorkingDir(path string) (*WorkingDir, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+	return &WorkingDir{Path: path}, nil
+}
+
+// Save atomically writes storage to the file name, prefixed with a header
+// holding the format version.
+func (w *WorkingDir) Save(name string, storage Persistable) error {
+	return w.writeFile(name, func(out io.Writer) error {
+		if _, err := out.Write(fileMagic[:]); err != nil {
+			return err
+		}
+		if err := binary.Write(out, binary.LittleEndian, uint32(FormatVersion)); err != nil {
+			return err
+		}
+		return storage.Save(out)
+	})
+}
+
+// Load reads storage from the file name. It reports false if the file does
+// not exist, leaving storage untouched.
+func (w *WorkingDir) Load(name string, storage Persistable) (bool, error) {
+	f, err := os.Open(filepath.Join(w.Path, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	in := bufio.NewReader(f)
+	var magic [4]byte
+	if _, err := io.ReadFull(in, magic[:]); err != nil || magic != fileMagic {
+		return false, fmt.Errorf("%w: %s", ErrInvalidFile, name)
+	}
+	var version uint32
+	if err := binary.Read(in, binary.LittleEndian, &version); err != nil {
+		return false, fmt.Errorf("%w: %s", ErrInvalidFile, name)
+	}
+	if version > FormatVersion {
+		return false, fmt.Errorf("%w: %s has version %d", ErrUnsupportedVersion, name, version)
+	}
+	if err := storage.Load(in); err != nil {
+		return false, fmt.Errorf("loading %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// SaveMetadata atomically writes the metadata file.
+func (w *WorkingDir) SaveMetadata(metadata WorkingDirMetadata) error {
+	return w.writeFile("metadata.json", func(out io.Writer) error {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(metadata)
+	})
+}
+
+// LoadMetadata reads the metadata file. It returns nil if the file does not exist.
+func (w *WorkingDir) LoadMetadata() (*WorkingDirMetadata, error) {
+	data, err := os.ReadFile(filepath.Join(w.Path, "metadata.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var metadata WorkingDirMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("loading metadata.json: %w", err)
+	}
+	if metadata.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("%w: working directory has version %d", ErrUnsupportedVersion, metadata.FormatVersion)
+	}
+	return &metadata, nil
+}
+
+// writeFile writes the file name through a synced temporary file which is
+// then renamed over it.
+func (w *WorkingDir) writeFile(name string, write func(io.Writer) error) (err error) {
+	tmp, err := os.CreateTemp(w.Path, "."+name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	out := bufio.NewWriter(tmp)
+	if err = write(out); err != nil {
+		return fmt.Errorf("saving %s: %w", name, err)
+	}
+	if err = out.Flush(); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(w.Path, name)); err != nil {
+		return err
+	}
+	return syncDir(w.Path)
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// failingStorage fails to save after writing part of its content.
+type failingStorage struct{}
+
+var errSave = errors.New("save failed")
+
+func (failingStorage) Save(w io.Writer) error {
+	w.Write([]byte("partial"))
+	return errSave
+}
+
+func (failingStorage) Load(r io.Reader) error { return nil }
+
+func TestWorkingDirSaveLoad(t *testing.T) {
+	dir, err := NewWorkingDir(filepath.Join(t.TempDir(), "workspace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemoryKVStorage[string, int]()
+	if err := s.Upsert([]string{"a"}, []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.Save("kv.gob", s); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewMemoryKVStorage[string, int]()
+	if ok, err := dir.Load("kv.gob", loaded); !ok || err != nil {
+		t.Fatalf("got %v, %v, want the saved file", ok, err)
+	}
+	if values := loaded.Get([]string{"a"}); values[0] == nil || *values[0] != 1 {
+		t.Errorf("got values %v, want 1", values)
+	}
+	if ok, err := dir.Load("missing.gob", loaded); ok || err != nil {
+		t.Errorf("got %v, %v for a missing file, want false, nil", ok, err)
+	}
+
+	metadata := WorkingDirMetadata{FormatVersion: FormatVersion, CreatedAt: time.Now().UTC().Truncate(time.Second), Chunks: 1}
+	if err := dir.SaveMetadata(metadata); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dir.LoadMetadata(); err != nil || *got != metadata {
+		t.Errorf("got metadata %+v, %v, want %+v", got, err, metadata)
+	}
+}
+
+func TestWorkingDirLoadErrors(t *testing.T) {
+	dir, err := NewWorkingDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := append(fileMagic[:], binary.LittleEndian.AppendUint32(nil, FormatVersion+1)...)
+	files := []struct {
+		name    string
+		content []byte
+		want    error
+	}{
+		{"magic.gob", []byte("GOB!\x01\x00\x00\x00"), ErrInvalidFile},
+		{"short.gob", fileMagic[:2], ErrInvalidFile},
+		{"version.gob", fileMagic[:], ErrInvalidFile},
+		{"future.gob", future, ErrUnsupportedVersion},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(dir.Path, file.name), file.content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dir.Load(file.name, NewMemoryKVStorage[string, int]()); !errors.Is(err, file.want) {
+			t.Errorf("%s: got %v, want %v", file.name, err, file.want)
+		}
+	}
+
+	if err := dir.SaveMetadata(WorkingDirMetadata{FormatVersion: FormatVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dir.LoadMetadata(); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("got %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestWorkingDirSaveFailure(t *testing.T) {
+	dir, err := NewWorkingDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemoryKVStorage[string, int]()
+	if err := dir.Save("kv.gob", s); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(filepath.Join(dir.Path, "kv.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed save leaves the previous version and no temporary file.
+	if err := dir.Save("kv.gob", failingStorage{}); !errors.Is(err, errSave) {
+		t.Fatalf("got %v, want the error of the storage", err)
+	}
+	after, err := os.ReadFile(filepath.Join(dir.Path, "kv.gob"))
+	if err != nil || string(after) != string(before) {
+		t.Errorf("the failed save changed the previous version")
+	}
+	entries, err := os.ReadDir(dir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("got files %v, want only kv.gob", names)
+	}
+}